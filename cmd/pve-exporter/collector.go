@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hilaoyu/go-pve-client/pve"
+)
+
+// collector gathers one scrape of a target into a metricSet.
+type collector struct {
+	target string
+	client *pve.Client
+	set    *metricSet
+	now    time.Time
+
+	mu sync.Mutex
+	// newest backup ctime by vmid and the storages already listed, shared
+	// storages show up on every node
+	backups  map[uint64]uint64
+	storages map[string]bool
+	// backupsIncomplete is set when a node, its storages or a backup listing
+	// could not be read, the newest backup of a guest is unknown then
+	backupsIncomplete bool
+}
+
+func collect(target string, client *pve.Client) *metricSet {
+	c := &collector{
+		target:   target,
+		client:   client,
+		set:      newMetricSet(),
+		now:      time.Now(),
+		backups:  map[uint64]uint64{},
+		storages: map[string]bool{},
+	}
+
+	cluster, err := client.Cluster()
+	if c.result("cluster", err) {
+		err = c.collectResources(cluster)
+	}
+	c.set.addBool("pve_scrape_success", nil == err)
+	c.set.add("pve_scrape_duration_seconds", time.Since(c.now).Seconds())
+	return c.set
+}
+
+func (c *collector) result(name string, err error) bool {
+	if nil != err {
+		log.Printf("target %s: collector %s: %s", c.target, name, err)
+	}
+	c.set.addBool("pve_collector_success", nil == err, "collector", name)
+	return nil == err
+}
+
+func (c *collector) collectResources(cluster *pve.Cluster) error {
+	resources, err := cluster.Resources()
+	if !c.result("resources", err) {
+		return err
+	}
+
+	var guests pve.ClusterResources
+	var wg sync.WaitGroup
+	for _, r := range resources {
+		switch r.Type {
+		case pve.ClusterResourceTypeNode:
+			c.set.add("pve_node_info", 1, "id", r.ID, "name", r.Node, "level", r.Level)
+			c.set.addBool("pve_up", "online" == r.Status, "id", r.ID)
+			if "online" == r.Status {
+				wg.Add(1)
+				go func(name string) {
+					defer wg.Done()
+					c.collectNode(name)
+				}(r.Node)
+			}
+		case pve.ClusterResourceTypeQemu, pve.ClusterResourceTypeLxc:
+			guests = append(guests, r)
+			c.set.add("pve_guest_info", 1, "id", r.ID, "node", r.Node, "name", r.Name, "type", string(r.Type), "pool", r.Pool)
+			c.set.addBool("pve_up", "running" == r.Status, "id", r.ID)
+			if "" != r.HAstate {
+				c.set.add("pve_ha_state", 1, "id", r.ID, "state", r.HAstate)
+			}
+		case pve.ClusterResourceTypeStorage:
+			c.set.add("pve_storage_info", 1, "id", r.ID, "node", r.Node, "storage", r.Storage, "plugin", r.PluginType, "content", r.Content)
+			c.set.addBool("pve_up", "available" == r.Status, "id", r.ID)
+		default:
+			continue
+		}
+
+		c.set.add("pve_disk_usage_bytes", float64(r.Disk), "id", r.ID)
+		c.set.add("pve_disk_size_bytes", float64(r.MaxDisk), "id", r.ID)
+		if pve.ClusterResourceTypeStorage == r.Type {
+			continue
+		}
+		c.set.add("pve_cpu_usage_ratio", r.CPU, "id", r.ID)
+		c.set.add("pve_cpu_usage_limit", float64(r.MaxCPU), "id", r.ID)
+		c.set.add("pve_memory_usage_bytes", float64(r.Mem), "id", r.ID)
+		c.set.add("pve_memory_size_bytes", float64(r.MaxMem), "id", r.ID)
+		c.set.add("pve_uptime_seconds", float64(r.Uptime), "id", r.ID)
+	}
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		c.collectHA(cluster)
+	}()
+	go func() {
+		defer wg.Done()
+		c.collectTasks(cluster)
+	}()
+	wg.Wait()
+
+	c.collectBackupAge(guests)
+	return nil
+}
+
+func (c *collector) collectNode(name string) {
+	node, err := c.client.Node(name)
+	if !c.result("node/"+name, err) {
+		c.setBackupsIncomplete()
+		return
+	}
+
+	id := "node/" + name
+	for i, metric := range []string{"pve_node_load1", "pve_node_load5", "pve_node_load15"} {
+		if i < len(node.LoadAvg) {
+			if load, err := strconv.ParseFloat(node.LoadAvg[i], 64); nil == err {
+				c.set.add(metric, load, "id", id)
+			}
+		}
+	}
+	c.set.add("pve_node_iowait_ratio", node.Wait, "id", id)
+	c.set.add("pve_node_swap_usage_bytes", float64(node.Swap.Used), "id", id)
+	c.set.add("pve_node_swap_size_bytes", float64(node.Swap.Total), "id", id)
+	c.set.add("pve_node_rootfs_usage_bytes", float64(node.RootFS.Used), "id", id)
+	c.set.add("pve_node_rootfs_size_bytes", float64(node.RootFS.Total), "id", id)
+
+	vms, err := node.VirtualMachines()
+	if c.result("qemu/"+name, err) {
+		for _, vm := range vms {
+			c.guestIO(fmt.Sprintf("qemu/%d", vm.VMID), vm.NetIn, vm.Netout, vm.DiskRead, vm.DiskWrite)
+		}
+	}
+	containers, err := node.LxcContainers()
+	if c.result("lxc/"+name, err) {
+		for _, ct := range containers {
+			c.guestIO(fmt.Sprintf("lxc/%d", ct.VMID), ct.NetIn, ct.NetOut, ct.DiskRead, ct.DiskWrite)
+		}
+	}
+
+	storages, err := node.Storages()
+	if !c.result("storage/"+name, err) {
+		c.setBackupsIncomplete()
+		return
+	}
+	for _, s := range storages {
+		id := fmt.Sprintf("storage/%s/%s", name, s.Name)
+		c.set.addBool("pve_storage_active", 1 == s.Active, "id", id)
+		c.set.addBool("pve_storage_enabled", 1 == s.Enabled, "id", id)
+		c.set.add("pve_storage_available_bytes", float64(s.Avail), "id", id)
+		c.collectBackups(s)
+	}
+}
+
+func (c *collector) guestIO(id string, netIn, netOut, diskRead, diskWrite uint64) {
+	c.set.add("pve_network_receive_bytes_total", float64(netIn), "id", id)
+	c.set.add("pve_network_transmit_bytes_total", float64(netOut), "id", id)
+	c.set.add("pve_disk_read_bytes_total", float64(diskRead), "id", id)
+	c.set.add("pve_disk_written_bytes_total", float64(diskWrite), "id", id)
+}
+
+func (c *collector) collectBackups(s *pve.Storage) {
+	if 1 != s.Active || 1 != s.Enabled || !strings.Contains(s.Content, "backup") {
+		return
+	}
+	key := s.Node + "/" + s.Name
+	if 1 == s.Shared {
+		key = s.Name
+	}
+	c.mu.Lock()
+	listed := c.storages[key]
+	c.storages[key] = true
+	c.mu.Unlock()
+	if listed {
+		return
+	}
+
+	backups, err := s.Backups()
+	if !c.result("backups/"+key, err) {
+		c.setBackupsIncomplete()
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, b := range backups {
+		vmid := uint64(b.VMID)
+		if b.CTime > c.backups[vmid] {
+			c.backups[vmid] = b.CTime
+		}
+	}
+}
+
+func (c *collector) setBackupsIncomplete() {
+	c.mu.Lock()
+	c.backupsIncomplete = true
+	c.mu.Unlock()
+}
+
+// collectBackupAge is skipped when a backup storage could not be read, a
+// missing backup would raise false alerts.
+func (c *collector) collectBackupAge(guests pve.ClusterResources) {
+	if c.backupsIncomplete {
+		return
+	}
+	for _, g := range guests {
+		ctime, ok := c.backups[uint64(g.VMID)]
+		c.set.addBool("pve_guest_backed_up", ok, "id", g.ID)
+		if ok {
+			c.set.add("pve_guest_last_backup_timestamp_seconds", float64(ctime), "id", g.ID)
+			c.set.add("pve_guest_backup_age_seconds", c.now.Sub(time.Unix(int64(ctime), 0)).Seconds(), "id", g.ID)
+		}
+	}
+}
+
+func (c *collector) collectHA(cluster *pve.Cluster) {
+	status, err := cluster.HAStatus()
+	if !c.result("ha", err) {
+		return
+	}
+	for _, s := range status {
+		switch s.Type {
+		case pve.HAStatusTypeQuorum:
+			c.set.addBool("pve_ha_quorum_ok", strings.HasPrefix(s.Status, "OK"))
+		case pve.HAStatusTypeLrm:
+			c.set.add("pve_ha_lrm_status", 1, "node", s.Node, "status", s.Status)
+		case pve.HAStatusTypeService:
+			c.set.add("pve_ha_service_state", 1, "sid", s.SID, "node", s.Node, "state", s.State)
+		}
+	}
+}
+
+func (c *collector) collectTasks(cluster *pve.Cluster) {
+	tasks, err := cluster.Tasks()
+	if !c.result("tasks", err) {
+		return
+	}
+
+	failed := map[[2]string]int{}
+	running := map[string]int{}
+	for _, t := range tasks {
+		if t.IsRunning {
+			running[t.Node]++
+		} else if t.IsFailed {
+			failed[[2]string{t.Node, t.Type}]++
+		}
+	}
+	for key, count := range failed {
+		c.set.add("pve_tasks_failed", float64(count), "node", key[0], "type", key[1])
+	}
+	for node, count := range running {
+		c.set.add("pve_tasks_running", float64(count), "node", node)
+	}
+}
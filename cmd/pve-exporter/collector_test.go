@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hilaoyu/go-pve-client/pve"
+)
+
+func TestCollectBackupAge(t *testing.T) {
+	guests := pve.ClusterResources{
+		{ID: "qemu/100", VMID: 100},
+		{ID: "qemu/101", VMID: 101},
+	}
+
+	tests := []struct {
+		name       string
+		incomplete bool
+		want       int
+	}{
+		{name: "complete", want: 2},
+		{name: "backup storage failed", incomplete: true, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &collector{
+				set:               newMetricSet(),
+				now:               time.Now(),
+				backups:           map[uint64]uint64{100: uint64(time.Now().Unix())},
+				backupsIncomplete: tt.incomplete,
+			}
+			c.collectBackupAge(guests)
+			if got := len(c.set.families["pve_guest_backed_up"]); got != tt.want {
+				t.Errorf("%d pve_guest_backed_up samples, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+// Command pve-exporter exposes Proxmox VE cluster, node, guest, storage, ha,
+// backup and task metrics in the prometheus text format.
+//
+// Targets come from a json config file:
+//
+//	{
+//	  "listen": ":9221",
+//	  "cache_ttl": "30s",
+//	  "timeout": "20s",
+//	  "targets": {
+//	    "pve1": {"url": "https://pve1:8006/api2/json", "token_id": "monitor@pve!exporter", "token_secret": "..."},
+//	    "lab": {"url": "https://lab:8006/api2/json", "username": "monitor@pve", "password": "...", "insecure": true}
+//	  }
+//	}
+//
+// or for a single target from -url and the PVE_TOKEN_ID and PVE_TOKEN_SECRET
+// or PVE_USER and PVE_PASSWORD environment variables. -listen, -cache-ttl and
+// -timeout given on the command line override the config file. Prometheus
+// scrapes /metrics?target=<name>, the target can be left out with only one
+// target.
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hilaoyu/go-pve-client/pve"
+)
+
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) (err error) {
+	var s string
+	if err = json.Unmarshal(b, &s); nil != err {
+		return
+	}
+	d.Duration, err = time.ParseDuration(s)
+	return
+}
+
+type TargetConfig struct {
+	URL         string `json:"url"`
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"`
+	TokenID     string `json:"token_id,omitempty"`
+	TokenSecret string `json:"token_secret,omitempty"`
+	// Insecure skips the verification of the self signed pve certificate
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+type Config struct {
+	Listen   string                   `json:"listen"`
+	CacheTTL Duration                 `json:"cache_ttl"`
+	Timeout  Duration                 `json:"timeout"`
+	Targets  map[string]*TargetConfig `json:"targets"`
+}
+
+// target caches the last scrape, concurrent scrapes wait for the running
+// one instead of hitting the api again.
+type target struct {
+	name   string
+	client *pve.Client
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	metrics *metricSet
+	at      time.Time
+}
+
+func newTarget(name string, tc *TargetConfig, timeout, ttl time.Duration) *target {
+	httpClient := &http.Client{Timeout: timeout}
+	if tc.Insecure {
+		httpClient.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+
+	opts := []pve.Option{pve.WithHttpClient(httpClient), pve.WithUserAgent("pve-exporter")}
+	if "" != tc.TokenID {
+		opts = append(opts, pve.WithAuthApiToken(tc.TokenID, tc.TokenSecret))
+	} else {
+		opts = append(opts, pve.WithAuthAccount(tc.Username, tc.Password))
+	}
+	return &target{name: name, client: pve.NewClient(tc.URL, opts...), ttl: ttl}
+}
+
+func (t *target) scrape() *metricSet {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if nil == t.metrics || time.Since(t.at) >= t.ttl {
+		t.metrics = collect(t.name, t.client)
+		t.at = time.Now()
+	}
+	return t.metrics
+}
+
+func loadConfig(path string) (config *Config, err error) {
+	config = &Config{}
+	if "" != path {
+		b, err := os.ReadFile(path)
+		if nil != err {
+			return nil, err
+		}
+		if err = json.Unmarshal(b, config); nil != err {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+	}
+	return config, nil
+}
+
+func main() {
+	configFile := flag.String("config", "", "json config file with the scrape targets")
+	listen := flag.String("listen", ":9221", "address to listen on")
+	url := flag.String("url", os.Getenv("PVE_URL"), "api url of a single target like https://pve:8006/api2/json")
+	insecure := flag.Bool("insecure", false, "skip tls verification of the single target")
+	cacheTTL := flag.Duration("cache-ttl", 30*time.Second, "how long a scrape result is reused")
+	timeout := flag.Duration("timeout", 20*time.Second, "timeout of a single api request")
+	flag.Parse()
+
+	config, err := loadConfig(*configFile)
+	if nil != err {
+		log.Fatal(err)
+	}
+	// flags given on the command line win over the config file, the
+	// defaults only fill what the file leaves out
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	if "" == config.Listen || set["listen"] {
+		config.Listen = *listen
+	}
+	if 0 == config.CacheTTL.Duration || set["cache-ttl"] {
+		config.CacheTTL.Duration = *cacheTTL
+	}
+	if 0 == config.Timeout.Duration || set["timeout"] {
+		config.Timeout.Duration = *timeout
+	}
+	if "" != *url {
+		if nil == config.Targets {
+			config.Targets = map[string]*TargetConfig{}
+		}
+		config.Targets["default"] = &TargetConfig{
+			URL:         *url,
+			Username:    os.Getenv("PVE_USER"),
+			Password:    os.Getenv("PVE_PASSWORD"),
+			TokenID:     os.Getenv("PVE_TOKEN_ID"),
+			TokenSecret: os.Getenv("PVE_TOKEN_SECRET"),
+			Insecure:    *insecure,
+		}
+	}
+	if 0 == len(config.Targets) {
+		log.Fatal("no targets, pass -config or -url")
+	}
+
+	targets := map[string]*target{}
+	var names []string
+	for name, tc := range config.Targets {
+		targets[name] = newTarget(name, tc, config.Timeout.Duration, config.CacheTTL.Duration)
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("target")
+		if "" == name && 1 == len(names) {
+			name = names[0]
+		}
+		t, ok := targets[name]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown target %q, configured are %v", name, names), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if _, err := t.scrape().WriteTo(w); nil != err {
+			log.Printf("target %s: write metrics: %s", name, err)
+		}
+	})
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "pve-exporter, scrape /metrics?target=<name>")
+		for _, name := range names {
+			fmt.Fprintf(w, "  %s  /metrics?target=%s\n", name, name)
+		}
+	})
+
+	log.Printf("listening on %s with targets %v", config.Listen, names)
+	log.Fatal(http.ListenAndServe(config.Listen, nil))
+}
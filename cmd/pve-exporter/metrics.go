@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var metricHelp = map[string]string{
+	"pve_up":                                  "Node online, guest running or storage available.",
+	"pve_cpu_usage_ratio":                     "CPU usage, 1 is one full core of cpu_usage_limit.",
+	"pve_cpu_usage_limit":                     "Number of available CPUs.",
+	"pve_memory_usage_bytes":                  "Used memory in bytes.",
+	"pve_memory_size_bytes":                   "Total memory in bytes.",
+	"pve_disk_usage_bytes":                    "Used disk space in bytes.",
+	"pve_disk_size_bytes":                     "Disk size in bytes.",
+	"pve_uptime_seconds":                      "Uptime in seconds.",
+	"pve_network_receive_bytes_total":         "Bytes received by the guest since it started.",
+	"pve_network_transmit_bytes_total":        "Bytes sent by the guest since it started.",
+	"pve_disk_read_bytes_total":               "Bytes read from disk by the guest since it started.",
+	"pve_disk_written_bytes_total":            "Bytes written to disk by the guest since it started.",
+	"pve_guest_info":                          "Guest details, always 1.",
+	"pve_node_info":                           "Node details, always 1.",
+	"pve_storage_info":                        "Storage details, always 1.",
+	"pve_ha_state":                            "HA state of the resource as reported in the cluster resources, always 1.",
+	"pve_node_load1":                          "Node load average over 1 minute.",
+	"pve_node_load5":                          "Node load average over 5 minutes.",
+	"pve_node_load15":                         "Node load average over 15 minutes.",
+	"pve_node_iowait_ratio":                   "Node cpu io wait.",
+	"pve_node_swap_usage_bytes":               "Node used swap in bytes.",
+	"pve_node_swap_size_bytes":                "Node total swap in bytes.",
+	"pve_node_rootfs_usage_bytes":             "Node used root filesystem space in bytes.",
+	"pve_node_rootfs_size_bytes":              "Node root filesystem size in bytes.",
+	"pve_storage_active":                      "Storage is active on the node.",
+	"pve_storage_enabled":                     "Storage is enabled on the node.",
+	"pve_storage_available_bytes":             "Storage space available in bytes.",
+	"pve_ha_quorum_ok":                        "HA manager reports quorum.",
+	"pve_ha_lrm_status":                       "Status of the HA local resource manager of a node, always 1.",
+	"pve_ha_service_state":                    "State of a HA managed service, always 1.",
+	"pve_guest_backed_up":                     "Guest has at least one backup on a storage.",
+	"pve_guest_last_backup_timestamp_seconds": "Creation time of the newest backup of the guest.",
+	"pve_guest_backup_age_seconds":            "Age of the newest backup of the guest.",
+	"pve_tasks_failed":                        "Tasks in the recent cluster task list that ended with a status other than OK, warnings included.",
+	"pve_tasks_running":                       "Running tasks in the recent cluster task list.",
+	"pve_collector_success":                   "Collector finished without error.",
+	"pve_scrape_success":                      "Cluster status and resources of the target could be read.",
+	"pve_scrape_duration_seconds":             "Time the scrape of the target took.",
+}
+
+// metricCounters are the families that only grow until the guest restarts,
+// everything else is a gauge.
+var metricCounters = map[string]bool{
+	"pve_network_receive_bytes_total":  true,
+	"pve_network_transmit_bytes_total": true,
+	"pve_disk_read_bytes_total":        true,
+	"pve_disk_written_bytes_total":     true,
+}
+
+type metricSample struct {
+	labels []string // name, value pairs
+	value  float64
+}
+
+// metricSet collects gauges and counters and writes them in the prometheus
+// text format.
+type metricSet struct {
+	mu       sync.Mutex
+	families map[string][]*metricSample
+}
+
+func newMetricSet() *metricSet {
+	return &metricSet{families: map[string][]*metricSample{}}
+}
+
+func (m *metricSet) add(name string, value float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.families[name] = append(m.families[name], &metricSample{labels: labels, value: value})
+}
+
+func (m *metricSet) addBool(name string, value bool, labels ...string) {
+	v := 0.0
+	if value {
+		v = 1
+	}
+	m.add(name, v, labels...)
+}
+
+func (m *metricSet) WriteTo(w io.Writer) (n int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.families))
+	for name := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var bw bytes.Buffer
+	for _, name := range names {
+		if help, ok := metricHelp[name]; ok {
+			bw.WriteString("# HELP " + name + " " + help + "\n")
+		}
+		kind := "gauge"
+		if metricCounters[name] {
+			kind = "counter"
+		}
+		bw.WriteString("# TYPE " + name + " " + kind + "\n")
+		for _, s := range m.families[name] {
+			bw.WriteString(name)
+			if len(s.labels) > 1 {
+				bw.WriteByte('{')
+				for i := 0; i+1 < len(s.labels); i += 2 {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					bw.WriteString(s.labels[i] + `="` + labelEscaper.Replace(s.labels[i+1]) + `"`)
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteString(" " + strconv.FormatFloat(s.value, 'g', -1, 64) + "\n")
+		}
+	}
+	return bw.WriteTo(w)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMetricSetWriteTo(t *testing.T) {
+	m := newMetricSet()
+	m.add("pve_up", 1, "id", "qemu/100")
+	m.add("pve_guest_info", 1, "id", "qemu/100", "node", "pve1", "name", `web "01"`, "type", "qemu", "pool", `a\b`)
+	m.add("pve_guest_info", 1, "id", "lxc/101", "node", "pve1", "name", "line\nbreak", "type", "lxc", "pool", "")
+	m.addBool("pve_up", false, "id", "lxc/101")
+	m.add("pve_scrape_duration_seconds", 0.25)
+	m.add("pve_custom_total", 1e21, "id", "x")
+	m.add("pve_network_receive_bytes_total", 1024, "id", "qemu/100")
+
+	want := `# TYPE pve_custom_total gauge
+pve_custom_total{id="x"} 1e+21
+# HELP pve_guest_info Guest details, always 1.
+# TYPE pve_guest_info gauge
+pve_guest_info{id="qemu/100",node="pve1",name="web \"01\"",type="qemu",pool="a\\b"} 1
+pve_guest_info{id="lxc/101",node="pve1",name="line\nbreak",type="lxc",pool=""} 1
+# HELP pve_network_receive_bytes_total Bytes received by the guest since it started.
+# TYPE pve_network_receive_bytes_total counter
+pve_network_receive_bytes_total{id="qemu/100"} 1024
+# HELP pve_scrape_duration_seconds Time the scrape of the target took.
+# TYPE pve_scrape_duration_seconds gauge
+pve_scrape_duration_seconds 0.25
+# HELP pve_up Node online, guest running or storage available.
+# TYPE pve_up gauge
+pve_up{id="qemu/100"} 1
+pve_up{id="lxc/101"} 0
+`
+
+	var b bytes.Buffer
+	n, err := m.WriteTo(&b)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("output\n%s\nwant\n%s", got, want)
+	}
+	if int64(b.Len()) != n {
+		t.Errorf("wrote %d bytes, reported %d", b.Len(), n)
+	}
+}
@@ -1,3 +1,11 @@
 module github.com/hilaoyu/go-pve-client
 
 go 1.22
+
+require (
+	github.com/buger/goterm v1.0.4
+	github.com/gorilla/websocket v1.5.3
+	github.com/jinzhu/copier v0.4.0
+)
+
+require golang.org/x/sys v0.0.0-20210331175145-43e1dd70ce54 // indirect
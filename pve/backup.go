@@ -0,0 +1,315 @@
+package pve
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	BackupModeSnapshot = "snapshot"
+	BackupModeSuspend  = "suspend"
+	BackupModeStop     = "stop"
+
+	BackupCompressNone = "0"
+	BackupCompressGzip = "gzip"
+	BackupCompressLzo  = "lzo"
+	BackupCompressZstd = "zstd"
+)
+
+// BackupPrune is the prune-backups option of backup jobs, vzdump and storages.
+type BackupPrune struct {
+	propertyStringState
+	KeepAll     int               `json:"keep-all,omitempty" pve:"keep-all"`
+	KeepLast    int               `json:"keep-last,omitempty" pve:"keep-last"`
+	KeepHourly  int               `json:"keep-hourly,omitempty" pve:"keep-hourly"`
+	KeepDaily   int               `json:"keep-daily,omitempty" pve:"keep-daily"`
+	KeepWeekly  int               `json:"keep-weekly,omitempty" pve:"keep-weekly"`
+	KeepMonthly int               `json:"keep-monthly,omitempty" pve:"keep-monthly"`
+	KeepYearly  int               `json:"keep-yearly,omitempty" pve:"keep-yearly"`
+	Extra       map[string]string `json:"extra,omitempty" pve:",extra"`
+}
+
+func (p *BackupPrune) String() string {
+	str, _ := MarshalPropertyString(p)
+	return str
+}
+
+// decodeBackupPrune reads prune-backups, pve returns it as property string
+// or as object depending on the endpoint and version.
+func decodeBackupPrune(raw json.RawMessage) (prune *BackupPrune, err error) {
+	if 0 == len(raw) || "null" == string(raw) {
+		return nil, nil
+	}
+
+	var str string
+	if err = json.Unmarshal(raw, &str); nil != err {
+		var obj map[string]json.RawMessage
+		if err = json.Unmarshal(raw, &obj); nil != err {
+			return nil, fmt.Errorf("prune-backups: %w", err)
+		}
+		items := make([]string, 0, len(obj))
+		for key, value := range obj {
+			items = append(items, key+"="+configValueString(value))
+		}
+		sort.Strings(items)
+		str = strings.Join(items, ",")
+	}
+	if "" == str {
+		return nil, nil
+	}
+
+	prune = &BackupPrune{}
+	err = UnmarshalPropertyString(str, prune)
+	return
+}
+
+type VzdumpOptions struct {
+	Mode     string
+	Compress string
+	Storage  string
+	// NotesTemplate supports the {{guestname}}, {{node}}, {{vmid}} and {{cluster}} variables
+	NotesTemplate string
+	Protected     bool
+	// Remove prunes old backups of the storage according to Prune or the storage settings
+	Remove  bool
+	Prune   *BackupPrune
+	BWLimit int // KiB/s
+	MailTo  string
+	Extra   map[string]interface{}
+}
+
+func (o *VzdumpOptions) params() map[string]interface{} {
+	data := map[string]interface{}{}
+	if nil == o {
+		return data
+	}
+	if "" != o.Mode {
+		data["mode"] = o.Mode
+	}
+	if "" != o.Compress {
+		data["compress"] = o.Compress
+	}
+	if "" != o.Storage {
+		data["storage"] = o.Storage
+	}
+	if "" != o.NotesTemplate {
+		data["notes-template"] = o.NotesTemplate
+	}
+	if o.Protected {
+		data["protected"] = 1
+	}
+	if o.Remove {
+		data["remove"] = 1
+	}
+	if nil != o.Prune {
+		data["prune-backups"] = o.Prune.String()
+	}
+	if o.BWLimit > 0 {
+		data["bwlimit"] = o.BWLimit
+	}
+	if "" != o.MailTo {
+		data["mailto"] = o.MailTo
+	}
+	for name, value := range o.Extra {
+		data[name] = value
+	}
+	return data
+}
+
+// Vzdump backs up the guests vmids of the node in one task.
+func (n *Node) Vzdump(opts *VzdumpOptions, vmids ...int) (task *Task, err error) {
+	if len(vmids) == 0 {
+		return nil, fmt.Errorf("no guests to back up")
+	}
+	ids := make([]string, 0, len(vmids))
+	for _, vmid := range vmids {
+		ids = append(ids, strconv.Itoa(vmid))
+	}
+	return vzdump(n.client, n.Name, strings.Join(ids, ","), opts)
+}
+
+func (v *VirtualMachine) Vzdump(opts *VzdumpOptions) (*Task, error) {
+	return vzdump(v.client, v.Node, strconv.FormatUint(uint64(v.VMID), 10), opts)
+}
+
+func (c *LxcContainer) Vzdump(opts *VzdumpOptions) (*Task, error) {
+	return vzdump(c.client, c.Node, strconv.FormatUint(uint64(c.VMID), 10), opts)
+}
+
+func vzdump(c *Client, node, vmids string, opts *VzdumpOptions) (task *Task, err error) {
+	data := opts.params()
+	data["vmid"] = vmids
+
+	var upid string
+	if err = c.Post(fmt.Sprintf("/nodes/%s/vzdump", node), data, &upid); err != nil {
+		return nil, err
+	}
+
+	return NewTask(upid, c), nil
+}
+
+// BackupJob is a scheduled backup of /cluster/backup. Enabled is always sent,
+// so set it for new jobs.
+type BackupJob struct {
+	ID               string       `json:"id,omitempty"`
+	Type             string       `json:"type,omitempty"`
+	Schedule         string       `json:"schedule,omitempty"`
+	Enabled          IntOrBool    `json:"enabled"`
+	Comment          string       `json:"comment,omitempty"`
+	Storage          string       `json:"storage,omitempty"`
+	Mode             string       `json:"mode,omitempty"`
+	Compress         string       `json:"compress,omitempty"`
+	VMID             string       `json:"vmid,omitempty"` // comma separated list
+	All              IntOrBool    `json:"all,omitempty"`
+	Exclude          string       `json:"exclude,omitempty"`
+	Node             string       `json:"node,omitempty"`
+	Pool             string       `json:"pool,omitempty"`
+	MailTo           string       `json:"mailto,omitempty"`
+	MailNotification string       `json:"mailnotification,omitempty"`
+	NotesTemplate    string       `json:"notes-template,omitempty"`
+	Protected        IntOrBool    `json:"protected,omitempty"`
+	PruneBackups     *BackupPrune `json:"-"`
+	RepeatMissed     IntOrBool    `json:"repeat-missed,omitempty"`
+	BWLimit          int          `json:"bwlimit,omitempty"`
+	NextRun          int64        `json:"next-run,omitempty"`
+
+	RawPruneBackups json.RawMessage `json:"prune-backups,omitempty"`
+}
+
+// VMIDs returns the guests of the job, empty for jobs selecting all guests or a pool.
+func (j *BackupJob) VMIDs() (vmids []int) {
+	for _, id := range strings.Split(j.VMID, ",") {
+		if vmid, err := strconv.Atoi(strings.TrimSpace(id)); nil == err {
+			vmids = append(vmids, vmid)
+		}
+	}
+	return
+}
+
+func (j *BackupJob) SetVMIDs(vmids ...int) {
+	ids := make([]string, 0, len(vmids))
+	for _, vmid := range vmids {
+		ids = append(ids, strconv.Itoa(vmid))
+	}
+	j.VMID = strings.Join(ids, ",")
+}
+
+// decode moves the prune-backups read from pve into PruneBackups, the raw
+// value is dropped so a PruneBackups cleared afterwards stays cleared.
+func (j *BackupJob) decode() (err error) {
+	if nil != j.RawPruneBackups {
+		j.PruneBackups, err = decodeBackupPrune(j.RawPruneBackups)
+		j.RawPruneBackups = nil
+	}
+	return
+}
+
+// params returns the writable settings, the id is only sent on create. On
+// update empty optional settings are cleared through delete and the flags
+// are sent as 0 too.
+func (j *BackupJob) params(create bool) map[string]interface{} {
+	data := map[string]interface{}{"enabled": boolToInt(bool(j.Enabled))}
+	var deletes []string
+	add := func(name, value string, clearable bool) {
+		if "" != value {
+			data[name] = value
+		} else if clearable && !create {
+			deletes = append(deletes, name)
+		}
+	}
+	flag := func(name string, value IntOrBool) {
+		if bool(value) || !create {
+			data[name] = boolToInt(bool(value))
+		}
+	}
+
+	if create {
+		add("id", j.ID, false)
+	}
+	add("schedule", j.Schedule, false)
+	add("storage", j.Storage, false)
+	add("mode", j.Mode, false)
+	add("comment", j.Comment, true)
+	add("compress", j.Compress, true)
+	add("vmid", j.VMID, true)
+	add("exclude", j.Exclude, true)
+	add("node", j.Node, true)
+	add("pool", j.Pool, true)
+	add("mailto", j.MailTo, true)
+	add("mailnotification", j.MailNotification, true)
+	add("notes-template", j.NotesTemplate, true)
+	prune := ""
+	if nil != j.PruneBackups {
+		prune = j.PruneBackups.String()
+	}
+	add("prune-backups", prune, true)
+	bwlimit := ""
+	if j.BWLimit > 0 {
+		bwlimit = strconv.Itoa(j.BWLimit)
+	}
+	add("bwlimit", bwlimit, true)
+	flag("all", j.All)
+	flag("protected", j.Protected)
+	flag("repeat-missed", j.RepeatMissed)
+
+	if len(deletes) > 0 {
+		data["delete"] = strings.Join(deletes, ",")
+	}
+	return data
+}
+
+func (cl *Cluster) BackupJobs() (jobs []*BackupJob, err error) {
+	if err = cl.client.Get("/cluster/backup", &jobs); nil != err {
+		return
+	}
+	for _, job := range jobs {
+		if err = job.decode(); nil != err {
+			return
+		}
+	}
+	return
+}
+
+func (cl *Cluster) BackupJob(id string) (job *BackupJob, err error) {
+	if err = cl.client.Get(fmt.Sprintf("/cluster/backup/%s", id), &job); nil != err {
+		return
+	}
+	err = job.decode()
+	return
+}
+
+// BackupJobCreate creates job, pve generates the id when job.ID is empty.
+func (cl *Cluster) BackupJobCreate(job *BackupJob) (err error) {
+	err = cl.client.Post("/cluster/backup", job.params(true), nil)
+	return
+}
+
+// BackupJobUpdate writes job as a whole, empty settings are removed from the
+// job, so update a job read with BackupJob.
+func (cl *Cluster) BackupJobUpdate(job *BackupJob) (err error) {
+	if "" == job.ID {
+		return fmt.Errorf("backup job has no id")
+	}
+	err = cl.client.Put(fmt.Sprintf("/cluster/backup/%s", job.ID), job.params(false), nil)
+	return
+}
+
+func (cl *Cluster) BackupJobDelete(id string) (err error) {
+	err = cl.client.Delete(fmt.Sprintf("/cluster/backup/%s", id), nil)
+	return
+}
+
+type NotBackedUpGuest struct {
+	VMID int    `json:"vmid"`
+	Name string `json:"name,omitempty"`
+	Type string `json:"type,omitempty"` // qemu or lxc
+}
+
+// NotBackedUp returns the guests not covered by any backup job.
+func (cl *Cluster) NotBackedUp() (guests []*NotBackedUpGuest, err error) {
+	err = cl.client.Get("/cluster/backup-info/not-backed-up", &guests)
+	return
+}
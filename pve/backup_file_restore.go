@@ -0,0 +1,79 @@
+package pve
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+)
+
+const (
+	FileRestoreTypeVirtual   = "v" // disk image or partition of the backup
+	FileRestoreTypeDirectory = "d"
+	FileRestoreTypeFile      = "f"
+	FileRestoreTypeSymlink   = "l"
+	FileRestoreTypeHardlink  = "h"
+)
+
+// FileRestoreEntry is one item of a backup browsed with FileRestoreList,
+// FilePath is the base64 encoded path pve expects back.
+type FileRestoreEntry struct {
+	FilePath string    `json:"filepath"`
+	Text     string    `json:"text"`
+	Type     string    `json:"type"`
+	Leaf     IntOrBool `json:"leaf"`
+	Size     uint64    `json:"size,omitempty"`
+	MTime    int64     `json:"mtime,omitempty"`
+}
+
+// Path returns the decoded path of the entry inside the backup.
+func (e *FileRestoreEntry) Path() string {
+	decoded, err := base64.StdEncoding.DecodeString(e.FilePath)
+	if nil != err {
+		return e.FilePath
+	}
+	return string(decoded)
+}
+
+func (e *FileRestoreEntry) Name() string {
+	if "" != e.Text {
+		return e.Text
+	}
+	return path.Base(e.Path())
+}
+
+// IsDir reports whether the entry can be listed, which includes the virtual
+// disk and partition entries.
+func (e *FileRestoreEntry) IsDir() bool {
+	return FileRestoreTypeDirectory == e.Type || FileRestoreTypeVirtual == e.Type
+}
+
+func (b *Backup) fileRestorePath(action, filePath string) string {
+	if "" == filePath {
+		filePath = "/"
+	}
+	return fmt.Sprintf("/nodes/%s/storage/%s/file-restore/%s?volume=%s&filepath=%s", b.Node, b.Storage, action,
+		url.QueryEscape(b.VolID), url.QueryEscape(base64.StdEncoding.EncodeToString([]byte(filePath))))
+}
+
+// FileRestoreList lists filePath inside the backup, "/" returns the disks of
+// the archive. Only backups on proxmox backup server support file restore.
+func (b *Backup) FileRestoreList(filePath string) (entries []*FileRestoreEntry, err error) {
+	err = b.client.Get(b.fileRestorePath("list", filePath), &entries)
+	return
+}
+
+func (b *Backup) FileRestoreListEntry(entry *FileRestoreEntry) ([]*FileRestoreEntry, error) {
+	return b.FileRestoreList(entry.Path())
+}
+
+// FileRestoreDownload streams filePath out of the backup to w, directories
+// come as zip archive or with tar as zstd compressed tar archive.
+func (b *Backup) FileRestoreDownload(filePath string, w io.Writer, tar ...bool) (n int64, err error) {
+	p := b.fileRestorePath("download", filePath)
+	if len(tar) > 0 && tar[0] {
+		p += "&tar=1"
+	}
+	return b.client.Download(p, w)
+}
@@ -0,0 +1,195 @@
+package pve
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	BackupTypeQemu = "qemu"
+	BackupTypeLxc  = "lxc"
+)
+
+type BackupRestoreOptions struct {
+	// VMID of the restored guest, the next free id is allocated when 0
+	VMID int
+	// Node to restore on, defaults to the node of the backup
+	Node    string
+	Storage string
+	// Unique regenerates mac addresses
+	Unique bool
+	// Force overwrites an existing guest with the same VMID
+	Force bool
+	// LiveRestore starts the vm while restoring, qemu backups on pbs only
+	LiveRestore bool
+	Start       bool
+	Pool        string
+	BWLimit     int // KiB/s
+	// Unprivileged restores a container as unprivileged, lxc only
+	Unprivileged *bool
+	Extra        map[string]interface{}
+}
+
+// GuestType returns qemu or lxc, taken from the subtype pve reports or
+// guessed from the volume name.
+func (b *Backup) GuestType() string {
+	if "" != b.Subtype {
+		return b.Subtype
+	}
+	volume := b.VolID
+	switch {
+	case strings.Contains(volume, "vzdump-qemu-"), strings.Contains(volume, "backup/vm/"), "pbs-vm" == b.Format:
+		return BackupTypeQemu
+	case strings.Contains(volume, "vzdump-lxc-"), strings.Contains(volume, "vzdump-openvz-"),
+		strings.Contains(volume, "backup/ct/"), "pbs-ct" == b.Format:
+		return BackupTypeLxc
+	}
+	return ""
+}
+
+func (b *Backup) restoreParams(vmid int, opts *BackupRestoreOptions) (data map[string]interface{}, err error) {
+	data = map[string]interface{}{"vmid": vmid}
+	switch b.GuestType() {
+	case BackupTypeQemu:
+		data["archive"] = b.VolID
+		if opts.LiveRestore {
+			data["live-restore"] = 1
+		}
+	case BackupTypeLxc:
+		data["ostemplate"] = b.VolID
+		data["restore"] = 1
+		if opts.LiveRestore {
+			return nil, fmt.Errorf("live restore is not supported for containers")
+		}
+		if nil != opts.Unprivileged {
+			data["unprivileged"] = boolToInt(*opts.Unprivileged)
+		}
+	default:
+		return nil, fmt.Errorf("unknown guest type of backup %s", b.VolID)
+	}
+
+	if "" != opts.Storage {
+		data["storage"] = opts.Storage
+	}
+	if opts.Unique {
+		data["unique"] = 1
+	}
+	if opts.Force {
+		data["force"] = 1
+	}
+	if opts.Start {
+		data["start"] = 1
+	}
+	if "" != opts.Pool {
+		data["pool"] = opts.Pool
+	}
+	if opts.BWLimit > 0 {
+		data["bwlimit"] = opts.BWLimit
+	}
+	for name, value := range opts.Extra {
+		data[name] = value
+	}
+	return
+}
+
+// Restore creates a vm or container from the backup and returns the restore
+// task with the vmid used.
+func (b *Backup) Restore(opts *BackupRestoreOptions) (task *Task, vmid int, err error) {
+	if nil == opts {
+		opts = &BackupRestoreOptions{}
+	}
+	guestType := b.GuestType()
+	if _, err = b.restoreParams(0, opts); nil != err {
+		return
+	}
+	node := opts.Node
+	if "" == node {
+		node = b.Node
+	}
+
+	var upid string
+	create := func(id int) error {
+		data, err := b.restoreParams(id, opts)
+		if nil != err {
+			return err
+		}
+		return b.client.Post(fmt.Sprintf("/nodes/%s/%s", node, guestType), data, &upid)
+	}
+
+	vmid = opts.VMID
+	if 0 == vmid {
+		cluster, err := b.client.Cluster()
+		if nil != err {
+			return nil, 0, err
+		}
+		if vmid, err = cluster.AllocateVMID(create); nil != err {
+			return nil, 0, err
+		}
+	} else if err = create(vmid); nil != err {
+		return
+	}
+
+	return NewTask(upid, b.client), vmid, nil
+}
+
+// ExtractConfig returns the guest config stored in the backup as is.
+func (b *Backup) ExtractConfig() (config string, err error) {
+	err = b.client.Get(fmt.Sprintf("/nodes/%s/vzdump/extractconfig?volume=%s", b.Node, url.QueryEscape(b.VolID)), &config)
+	return
+}
+
+// ExtractVirtualMachineConfig parses the config of a qemu backup, snapshot
+// sections are skipped.
+func (b *Backup) ExtractVirtualMachineConfig() (config *VirtualMachineConfig, err error) {
+	raw, err := b.ExtractConfig()
+	if nil != err {
+		return
+	}
+	return ParseVirtualMachineConfigFile(raw)
+}
+
+// ParseVirtualMachineConfigFile parses the main section of a qemu-server
+// config file, comment lines make up the description.
+func ParseVirtualMachineConfigFile(raw string) (config *VirtualMachineConfig, err error) {
+	config = &VirtualMachineConfig{}
+	var description []string
+
+	scanner := bufio.NewScanner(strings.NewReader(raw))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			break
+		}
+		if "" == line {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			comment, err := url.PathUnescape(strings.TrimPrefix(line, "#"))
+			if nil != err {
+				comment = strings.TrimPrefix(line, "#")
+			}
+			description = append(description, comment)
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid config line %q", line)
+		}
+		if err = config.Set(strings.TrimSpace(key), strings.TrimSpace(value)); nil != err {
+			return nil, err
+		}
+	}
+	if err = scanner.Err(); nil != err {
+		return nil, err
+	}
+
+	if len(description) > 0 && "" == config.Description {
+		if err = config.Set("description", strings.Join(description, "\n")); nil != err {
+			return nil, err
+		}
+	}
+	return
+}
@@ -0,0 +1,64 @@
+package pve
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBackupJobUpdateClearsPruneBackups(t *testing.T) {
+	tests := []struct {
+		name  string
+		prune interface{}
+	}{
+		{name: "string", prune: "keep-daily=7,keep-last=3"},
+		{name: "object", prune: map[string]interface{}{"keep-last": 3, "keep-daily": "7"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent map[string]interface{}
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case http.MethodGet == r.Method && "/cluster/backup/job1" == r.URL.Path:
+					writeTestData(w, map[string]interface{}{
+						"id":            "job1",
+						"schedule":      "daily",
+						"storage":       "local",
+						"enabled":       1,
+						"prune-backups": tt.prune,
+					})
+				case http.MethodPut == r.Method && "/cluster/backup/job1" == r.URL.Path:
+					if err := json.NewDecoder(r.Body).Decode(&sent); nil != err {
+						t.Error(err)
+					}
+					writeTestData(w, nil)
+				default:
+					http.NotFound(w, r)
+				}
+			})
+			cluster := &Cluster{client: client}
+
+			job, err := cluster.BackupJob("job1")
+			if nil != err {
+				t.Fatal(err)
+			}
+			if nil == job.PruneBackups || 3 != job.PruneBackups.KeepLast || 7 != job.PruneBackups.KeepDaily {
+				t.Fatalf("prune-backups decoded to %+v", job.PruneBackups)
+			}
+
+			job.PruneBackups = nil
+			if err = cluster.BackupJobUpdate(job); nil != err {
+				t.Fatal(err)
+			}
+			if value, ok := sent["prune-backups"]; ok {
+				t.Errorf("cleared prune-backups sent as %v", value)
+			}
+			deletes, _ := sent["delete"].(string)
+			if !strings.Contains(","+deletes+",", ",prune-backups,") {
+				t.Errorf("prune-backups not deleted, delete is %q", deletes)
+			}
+		})
+	}
+}
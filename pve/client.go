@@ -17,6 +17,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -53,6 +54,31 @@ var (
 	ErrTimeout       = errors.New("the operation has timed out")
 )
 
+type ConfigConflictError struct {
+	Digest string
+	Err    error
+}
+
+func (e *ConfigConflictError) Error() string {
+	return fmt.Sprintf("config changed since digest %s was read: %v", e.Digest, e.Err)
+}
+
+func (e *ConfigConflictError) Unwrap() error {
+	return e.Err
+}
+
+func IsConfigConflict(err error) bool {
+	var conflict *ConfigConflictError
+	return errors.As(err, &conflict)
+}
+
+// pve words digest mismatches differently depending on the endpoint
+var regexpConfigConflict = regexp.MustCompile(`(?i)checksum mis+match|detected modified configuration|file changed? by other user`)
+
+func isConfigConflict(err error) bool {
+	return nil != err && regexpConfigConflict.MatchString(err.Error())
+}
+
 func IsNotAuthorized(err error) bool {
 	return err == ErrNotAuthorized
 }
@@ -114,6 +140,23 @@ func (c *Client) Version() (*Version, error) {
 }
 
 func (c *Client) Req(method, path string, data []byte, v interface{}) error {
+	return c.req(method, path, data, v, false)
+}
+
+// relogin starts a new session after a 401, also when the ticket of the
+// current one expired. It is tried once per request.
+func (c *Client) relogin(retried bool) (bool, error) {
+	if nil == c.credentials || retried {
+		return false, nil
+	}
+	c.session = nil
+	if _, err := c.Ticket(c.credentials); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *Client) req(method, path string, data []byte, v interface{}, retried bool) error {
 	if strings.HasPrefix(path, "/") {
 		path = c.baseURL + path
 	}
@@ -152,12 +195,11 @@ func (c *Client) Req(method, path string, data []byte, v interface{}) error {
 	defer res.Body.Close()
 
 	if res.StatusCode == http.StatusUnauthorized && path != (c.baseURL+"/access/ticket") {
-		if c.credentials != nil && c.session == nil {
-			// credentials passed but no session started, try a login and retry the request
-			if _, err := c.Ticket(c.credentials); err != nil {
-				return err
-			}
-			return c.Req(method, path, data, v)
+		// no session started yet or its ticket expired, log in and retry once
+		if ok, err := c.relogin(retried); nil != err {
+			return err
+		} else if ok {
+			return c.req(method, path, data, v, true)
 		}
 		return ErrNotAuthorized
 	}
@@ -250,6 +292,49 @@ func (c *Client) Delete(p string, v interface{}) error {
 	return c.Req(http.MethodDelete, p, nil, v)
 }
 
+// Download streams the raw response body of a GET to w, for endpoints that
+// return files instead of json.
+func (c *Client) Download(path string, w io.Writer) (n int64, err error) {
+	return c.download(path, w, false)
+}
+
+func (c *Client) download(path string, w io.Writer, retried bool) (n int64, err error) {
+	if strings.HasPrefix(path, "/") {
+		path = c.baseURL + path
+	}
+
+	c.logger.InfoF("SEND: %s - %s", http.MethodGet, path)
+
+	req, err := http.NewRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return 0, err
+	}
+	c.authHeaders(&req.Header)
+	req.Header.Set("Accept", "*/*")
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusUnauthorized {
+		if ok, err := c.relogin(retried); nil != err {
+			return 0, err
+		} else if ok {
+			return c.download(path, w, true)
+		}
+		return 0, ErrNotAuthorized
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		return 0, fmt.Errorf("download failed: %s - %s", res.Status, strings.TrimSpace(string(body)))
+	}
+
+	c.logger.DebugF("RECV: %d - %s", res.StatusCode, res.Status)
+	return io.Copy(w, res.Body)
+}
+
 func (c *Client) authHeaders(header *http.Header) {
 	header.Add("User-Agent", c.userAgent)
 	header.Add("Accept", "application/json")
@@ -0,0 +1,76 @@
+package pve
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestClient returns a client talking to handler, which sees the api paths
+// without the /api2/json prefix.
+func newTestClient(t *testing.T, handler http.HandlerFunc, opts ...Option) *Client {
+	t.Helper()
+	srv := httptest.NewServer(http.StripPrefix("/api2/json", handler))
+	t.Cleanup(srv.Close)
+	if 0 == len(opts) {
+		opts = []Option{WithAuthApiToken("test@pve!test", "secret")}
+	}
+	return NewClient(srv.URL+"/api2/json", opts...)
+}
+
+func writeTestData(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func TestClientRelogin(t *testing.T) {
+	tests := []struct {
+		name      string
+		expire    bool
+		rejectAll bool
+		wantErr   error
+		logins    int
+	}{
+		{name: "first login", logins: 1},
+		{name: "expired ticket", expire: true, logins: 2},
+		{name: "rejected", rejectAll: true, wantErr: ErrNotAuthorized, logins: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logins := 0
+			valid := ""
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if "/access/ticket" == r.URL.Path {
+					logins++
+					valid = fmt.Sprintf("ticket%d", logins)
+					writeTestData(w, map[string]interface{}{"username": "root@pam", "ticket": valid, "CSRFPreventionToken": "csrf"})
+					return
+				}
+				if tt.rejectAll || r.Header.Get("Cookie") != "PVEAuthCookie="+valid {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				writeTestData(w, map[string]interface{}{"version": "8.2"})
+			}, WithAuthAccount("root@pam", "secret"))
+
+			if !tt.rejectAll {
+				if _, err := client.Version(); nil != err {
+					t.Fatal(err)
+				}
+			}
+			if tt.expire {
+				valid = "expired"
+			}
+			_, err := client.Version()
+			if err != tt.wantErr {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+			if logins != tt.logins {
+				t.Errorf("logged in %d times, want %d", logins, tt.logins)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package pve
 import (
 	"encoding/json"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -75,27 +76,241 @@ func (cl *Cluster) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+type ClusterResourceType string
+
+const (
+	// ClusterResourceTypeVM is a filter only, it matches qemu and lxc guests
+	ClusterResourceTypeVM      ClusterResourceType = "vm"
+	ClusterResourceTypeQemu    ClusterResourceType = "qemu"
+	ClusterResourceTypeLxc     ClusterResourceType = "lxc"
+	ClusterResourceTypeNode    ClusterResourceType = "node"
+	ClusterResourceTypeStorage ClusterResourceType = "storage"
+	ClusterResourceTypeSDN     ClusterResourceType = "sdn"
+	ClusterResourceTypePool    ClusterResourceType = "pool"
+)
+
+// Matches reports whether a resource of type resourceType passes the filter t.
+func (t ClusterResourceType) Matches(resourceType ClusterResourceType) bool {
+	if ClusterResourceTypeVM == t {
+		return ClusterResourceTypeQemu == resourceType || ClusterResourceTypeLxc == resourceType
+	}
+	return t == resourceType
+}
+
+// the type values the api filters itself
+var clusterResourceAPIFilters = map[ClusterResourceType]struct{}{
+	ClusterResourceTypeVM:      {},
+	ClusterResourceTypeNode:    {},
+	ClusterResourceTypeStorage: {},
+	ClusterResourceTypeSDN:     {},
+}
+
 type ClusterResources []*ClusterResource
 
 type ClusterResource struct {
-	ID         string  `jsont:"id"`
-	Type       string  `json:"type"`
-	Content    string  `json:",omitempty"`
-	CPU        float64 `json:",omitempty"`
-	Disk       uint64  `json:",omitempty"` // documented as string but this is an int
-	HAstate    string  `json:",omitempty"`
-	Level      string  `json:",omitempty"`
-	MaxCPU     uint64  `json:",omitempty"`
-	MaxDisk    uint64  `json:",omitempty"`
-	MaxMem     uint64  `json:",omitempty"`
-	Mem        uint64  `json:",omitempty"` // documented as string but this is an int
-	Name       string  `json:",omitempty"`
-	Node       string  `json:",omitempty"`
-	PluginType string  `json:",omitempty"`
-	Pool       string  `json:",omitempty"`
-	Status     string  `json:",omitempty"`
-	Storage    string  `json:",omitempty"`
-	Uptime     uint64  `json:",omitempty"`
+	client *Client
+
+	ID         string              `json:"id"`
+	Type       ClusterResourceType `json:"type"`
+	Content    string              `json:",omitempty"`
+	CPU        float64             `json:",omitempty"`
+	Disk       uint64              `json:",omitempty"` // documented as string but this is an int
+	DiskRead   uint64              `json:",omitempty"`
+	DiskWrite  uint64              `json:",omitempty"`
+	HAstate    string              `json:",omitempty"`
+	Level      string              `json:",omitempty"`
+	Lock       string              `json:",omitempty"`
+	MaxCPU     uint64              `json:",omitempty"`
+	MaxDisk    uint64              `json:",omitempty"`
+	MaxMem     uint64              `json:",omitempty"`
+	Mem        uint64              `json:",omitempty"` // documented as string but this is an int
+	Name       string              `json:",omitempty"`
+	NetIn      uint64              `json:",omitempty"`
+	NetOut     uint64              `json:",omitempty"`
+	Node       string              `json:",omitempty"`
+	PluginType string              `json:",omitempty"`
+	Pool       string              `json:",omitempty"`
+	SDN        string              `json:",omitempty"`
+	Shared     IntOrBool           `json:",omitempty"`
+	Status     string              `json:",omitempty"`
+	Storage    string              `json:",omitempty"`
+	Tags       string              `json:",omitempty"` // separated by ;
+	Template   IntOrBool           `json:",omitempty"`
+	Uptime     uint64              `json:",omitempty"`
+	VMID       StringOrUint64      `json:",omitempty"`
+}
+
+// TagList returns the tags of a guest.
+func (r *ClusterResource) TagList() []string {
+	return strings.FieldsFunc(r.Tags, func(c rune) bool { return ';' == c || ',' == c || ' ' == c })
+}
+
+func (r *ClusterResource) mustBe(t ClusterResourceType) error {
+	if t != r.Type {
+		return fmt.Errorf("resource %s is a %s, not a %s", r.ID, r.Type, t)
+	}
+	return nil
+}
+
+// ToVirtualMachine returns a handle of the qemu resource filled from the
+// resource list, the config is not loaded.
+func (r *ClusterResource) ToVirtualMachine() (*VirtualMachine, error) {
+	if err := r.mustBe(ClusterResourceTypeQemu); nil != err {
+		return nil, err
+	}
+	return &VirtualMachine{
+		client:    r.client,
+		Name:      r.Name,
+		Node:      r.Node,
+		VMID:      r.VMID,
+		Status:    r.Status,
+		Lock:      r.Lock,
+		CPU:       r.CPU,
+		CPUs:      int(r.MaxCPU),
+		Mem:       r.Mem,
+		MaxMem:    r.MaxMem,
+		Disk:      r.Disk,
+		MaxDisk:   r.MaxDisk,
+		DiskRead:  r.DiskRead,
+		DiskWrite: r.DiskWrite,
+		NetIn:     r.NetIn,
+		Netout:    r.NetOut,
+		Uptime:    r.Uptime,
+		Template:  IsTemplate(r.Template),
+		Tags:      r.Tags,
+	}, nil
+}
+
+// ToLxcContainer returns a handle of the lxc resource filled from the resource
+// list, the config is not loaded.
+func (r *ClusterResource) ToLxcContainer() (*LxcContainer, error) {
+	if err := r.mustBe(ClusterResourceTypeLxc); nil != err {
+		return nil, err
+	}
+	return &LxcContainer{
+		client:    r.client,
+		Name:      r.Name,
+		Node:      r.Node,
+		VMID:      r.VMID,
+		Status:    r.Status,
+		Lock:      r.Lock,
+		CPU:       r.CPU,
+		CPUs:      int(r.MaxCPU),
+		Mem:       r.Mem,
+		MaxMem:    r.MaxMem,
+		Disk:      r.Disk,
+		MaxDisk:   r.MaxDisk,
+		DiskRead:  r.DiskRead,
+		DiskWrite: r.DiskWrite,
+		NetIn:     r.NetIn,
+		NetOut:    r.NetOut,
+		Uptime:    r.Uptime,
+		Tags:      r.Tags,
+		Template:  r.Template,
+	}, nil
+}
+
+// ToStorage returns a handle of the storage resource. The resource list only
+// has the storages enabled on the node, available means active and unknown
+// inactive; Enabled stays 0 as the list does not report it.
+func (r *ClusterResource) ToStorage() (*Storage, error) {
+	if err := r.mustBe(ClusterResourceTypeStorage); nil != err {
+		return nil, err
+	}
+	storage := &Storage{
+		client:  r.client,
+		Node:    r.Node,
+		Name:    r.Storage,
+		Storage: r.Storage,
+		Content: r.Content,
+		Type:    r.PluginType,
+		Used:    r.Disk,
+		Total:   r.MaxDisk,
+	}
+	if r.Shared {
+		storage.Shared = 1
+	}
+	if "available" == r.Status {
+		storage.Active = 1
+	}
+	if r.MaxDisk > 0 {
+		storage.Avail = remaining(r.MaxDisk, r.Disk)
+		storage.UsedFraction = float64(r.Disk) / float64(r.MaxDisk)
+	}
+	return storage, nil
+}
+
+func (r *ClusterResource) ToNode() (*Node, error) {
+	if err := r.mustBe(ClusterResourceTypeNode); nil != err {
+		return nil, err
+	}
+	return &Node{
+		client: r.client,
+		Name:   r.Node,
+		Status: r.Status,
+		Level:  r.Level,
+		CPU:    r.CPU,
+		Uptime: r.Uptime,
+		Memory: Memory{Used: r.Mem, Free: remaining(r.MaxMem, r.Mem), Total: r.MaxMem},
+		RootFS: RootFS{Used: r.Disk, Total: r.MaxDisk, Avail: remaining(r.MaxDisk, r.Disk), Free: remaining(r.MaxDisk, r.Disk)},
+	}, nil
+}
+
+// remaining avoids the wrap around when an offline resource reports no total
+func remaining(total, used uint64) uint64 {
+	if used > total {
+		return 0
+	}
+	return total - used
+}
+
+// Filter returns the resources matching any of types.
+func (rs ClusterResources) Filter(types ...ClusterResourceType) (filtered ClusterResources) {
+	for _, r := range rs {
+		for _, t := range types {
+			if t.Matches(r.Type) {
+				filtered = append(filtered, r)
+				break
+			}
+		}
+	}
+	return
+}
+
+func (rs ClusterResources) VirtualMachines() (vms VirtualMachines) {
+	for _, r := range rs {
+		if vm, err := r.ToVirtualMachine(); nil == err {
+			vms = append(vms, vm)
+		}
+	}
+	return
+}
+
+func (rs ClusterResources) LxcContainers() (containers LxcContainers) {
+	for _, r := range rs {
+		if c, err := r.ToLxcContainer(); nil == err {
+			containers = append(containers, c)
+		}
+	}
+	return
+}
+
+func (rs ClusterResources) Storages() (storages Storages) {
+	for _, r := range rs {
+		if s, err := r.ToStorage(); nil == err {
+			storages = append(storages, s)
+		}
+	}
+	return
+}
+
+func (rs ClusterResources) Nodes() (nodes []*Node) {
+	for _, r := range rs {
+		if n, err := r.ToNode(); nil == err {
+			nodes = append(nodes, n)
+		}
+	}
+	return
 }
 
 func (c *Client) Cluster() (*Cluster, error) {
@@ -111,18 +326,107 @@ func (c *Client) Cluster() (*Cluster, error) {
 
 func (cl *Cluster) NextID() (int, error) {
 	var ret string
-	cl.client.Get("/cluster/nextid", &ret)
+	if err := cl.client.Get("/cluster/nextid", &ret); err != nil {
+		return 0, err
+	}
 	return strconv.Atoi(ret)
 }
 
-func (cl *Cluster) Resources(filters ...string) (rs ClusterResources, err error) {
+const DefaultVMIDRetries = 5
+
+// only the vmid messages of pve, a volume or file that already exists must
+// not be retried with another vmid
+var regexpVMIDConflict = regexp.MustCompile(`\b(VM|CT) \d+ already exists`)
+
+// AllocateVMID calls create with the next free vmid and retries with a fresh
+// one when create fails because a concurrent create took the same id. pve
+// checks the vmid again in the task worker, create has to wait for its task
+// to see those conflicts, see AllocateVMIDTask.
+func (cl *Cluster) AllocateVMID(create func(vmid int) error, retries ...int) (vmid int, err error) {
+	tries := DefaultVMIDRetries
+	if len(retries) > 0 && retries[0] >= 0 {
+		tries = retries[0]
+	}
+
+	for attempt := 0; attempt <= tries; attempt++ {
+		if vmid, err = cl.NextID(); err != nil {
+			return
+		}
+		err = create(vmid)
+		if nil == err || !regexpVMIDConflict.MatchString(err.Error()) {
+			return
+		}
+		cl.client.logger.DebugF("vmid %d taken concurrently, retry %d of %d", vmid, attempt+1, tries)
+	}
+
+	return
+}
+
+// AllocateVMIDTask is AllocateVMID for creates that run as a task, the task
+// is waited for and a vmid conflict reported by the failed task is retried.
+func (cl *Cluster) AllocateVMIDTask(create func(vmid int) (*Task, error), timesNum int, stepSeconds ...int) (vmid int, task *Task, err error) {
+	vmid, err = cl.AllocateVMID(func(id int) (err error) {
+		if task, err = create(id); nil != err || nil == task {
+			return
+		}
+		return task.WaitForComplete(timesNum, stepSeconds...)
+	})
+	return
+}
+
+// Resources returns the resources of the whole cluster matching any of the
+// type names in filters, all without filters. See ResourcesOfType.
+func (cl *Cluster) Resources(filters ...string) (ClusterResources, error) {
+	types := make([]ClusterResourceType, 0, len(filters))
+	for _, f := range filters {
+		if f = strings.TrimSpace(f); "" != f {
+			types = append(types, ClusterResourceType(f))
+		}
+	}
+	return cl.ResourcesOfType(types...)
+}
+
+// ResourcesOfType returns the resources of the whole cluster matching any of
+// types, all without types. A single vm, node, storage or sdn type is applied
+// by the api, everything else after the request.
+func (cl *Cluster) ResourcesOfType(types ...ClusterResourceType) (rs ClusterResources, err error) {
 	url := "/cluster/resources"
+	if 1 == len(types) {
+		if _, ok := clusterResourceAPIFilters[types[0]]; ok {
+			url = fmt.Sprintf("%s?type=%s", url, types[0])
+		}
+	}
+
+	if err = cl.client.Get(url, &rs); nil != err {
+		return
+	}
+	if len(types) > 0 {
+		rs = rs.Filter(types...)
+	}
+	for _, r := range rs {
+		r.client = cl.client
+	}
+	return
+}
 
-	// filters are variadic because they're optional, munging everything passed into one big string to make
-	// a good request and the api will error out if there's an issue
-	if f := strings.Replace(strings.Join(filters, ""), " ", "", -1); f != "" {
-		url = fmt.Sprintf("%s?type=%s", url, f)
+// Tasks returns the recent tasks of all nodes with the flags set like after
+// Task.Ping, every exit status but OK fails, WARNINGS included.
+func (cl *Cluster) Tasks() (tasks Tasks, err error) {
+	if err = cl.client.Get("/cluster/tasks", &tasks); nil != err {
+		return
 	}
 
-	return rs, cl.client.Get(url, &rs)
+	for _, t := range tasks {
+		t.client = cl.client
+		if t.EndTime.IsZero() || TaskRunning == t.Status {
+			t.IsRunning = true
+			continue
+		}
+		// the list returns the exit status in status
+		t.ExitStatus, t.Status = t.Status, "stopped"
+		t.IsCompleted = true
+		t.IsSuccessful = "OK" == t.ExitStatus
+		t.IsFailed = !t.IsSuccessful
+	}
+	return
 }
@@ -79,3 +79,23 @@ type FirewallRule struct {
 func (r *FirewallRule) IsEnable() bool {
 	return 1 == r.Enable
 }
+
+type FirewallIPSet struct {
+	Name    string `json:"name,omitempty"`
+	Comment string `json:"comment,omitempty"`
+	Digest  string `json:"digest,omitempty"`
+}
+
+type FirewallIPSetEntry struct {
+	CIDR    string `json:"cidr,omitempty"`
+	Comment string `json:"comment,omitempty"`
+	NoMatch int    `json:"nomatch,omitempty"`
+	Digest  string `json:"digest,omitempty"`
+}
+
+type FirewallAlias struct {
+	Name    string `json:"name,omitempty"`
+	CIDR    string `json:"cidr,omitempty"`
+	Comment string `json:"comment,omitempty"`
+	Digest  string `json:"digest,omitempty"`
+}
@@ -0,0 +1,28 @@
+package pve
+
+const (
+	HAStatusTypeQuorum  = "quorum"
+	HAStatusTypeMaster  = "master"
+	HAStatusTypeLrm     = "lrm"
+	HAStatusTypeService = "service"
+)
+
+type HAStatus struct {
+	ID           string    `json:"id"`
+	Type         string    `json:"type"`
+	Node         string    `json:"node,omitempty"`
+	Status       string    `json:"status"`
+	SID          string    `json:"sid,omitempty"` // service id like vm:100
+	State        string    `json:"state,omitempty"`
+	CRMState     string    `json:"crm_state,omitempty"`
+	RequestState string    `json:"request_state,omitempty"`
+	Quorate      IntOrBool `json:"quorate,omitempty"`
+	Timestamp    uint64    `json:"timestamp,omitempty"`
+}
+
+// HAStatus returns the current state of the ha manager, one entry for the
+// quorum, the master, every lrm and every managed service.
+func (cl *Cluster) HAStatus() (status []*HAStatus, err error) {
+	err = cl.client.Get("/cluster/ha/status/current", &status)
+	return
+}
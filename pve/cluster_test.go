@@ -0,0 +1,59 @@
+package pve
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClusterResources(t *testing.T) {
+	var query string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		writeTestData(w, []map[string]interface{}{
+			{"id": "qemu/100", "type": "qemu", "vmid": 100},
+			{"id": "lxc/101", "type": "lxc", "vmid": 101},
+			{"id": "node/pve1", "type": "node", "node": "pve1"},
+		})
+	})
+	cluster := &Cluster{client: client}
+
+	filter := "qemu"
+	tests := []struct {
+		name    string
+		get     func() (ClusterResources, error)
+		query   string
+		wantIDs []string
+	}{
+		{name: "all", get: func() (ClusterResources, error) { return cluster.Resources() }, wantIDs: []string{"qemu/100", "lxc/101", "node/pve1"}},
+		{name: "string variable", get: func() (ClusterResources, error) { return cluster.Resources(filter) }, wantIDs: []string{"qemu/100"}},
+		{name: "api filter", get: func() (ClusterResources, error) { return cluster.Resources("vm") }, query: "type=vm", wantIDs: []string{"qemu/100", "lxc/101"}},
+		{name: "typed", get: func() (ClusterResources, error) {
+			return cluster.ResourcesOfType(ClusterResourceTypeLxc, ClusterResourceTypeNode)
+		}, wantIDs: []string{"lxc/101", "node/pve1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, err := tt.get()
+			if nil != err {
+				t.Fatal(err)
+			}
+			if query != tt.query {
+				t.Errorf("query %q, want %q", query, tt.query)
+			}
+			var ids []string
+			for _, r := range rs {
+				ids = append(ids, r.ID)
+			}
+			if len(ids) != len(tt.wantIDs) {
+				t.Fatalf("got %v, want %v", ids, tt.wantIDs)
+			}
+			for i := range ids {
+				if ids[i] != tt.wantIDs[i] {
+					t.Errorf("got %v, want %v", ids, tt.wantIDs)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package pve
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var regexpConfigDevice = regexp.MustCompile(`^([a-z]+)(\d+)$`)
+
+// guestConfigSchema describes a vm or container config: the scalar fields by
+// their json name, the indexed device keys with the number of slots pve
+// allows and the keys that can not be posted back.
+type guestConfigSchema struct {
+	scalars      map[string]int
+	deviceLimits map[string]int
+	readOnly     map[string]struct{}
+}
+
+func newGuestConfigSchema(config interface{}, deviceLimits map[string]int, readOnly ...string) *guestConfigSchema {
+	s := &guestConfigSchema{
+		scalars:      map[string]int{},
+		deviceLimits: deviceLimits,
+		readOnly:     map[string]struct{}{},
+	}
+	t := reflect.TypeOf(config)
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if "" == name || "-" == name {
+			continue
+		}
+		s.scalars[name] = i
+	}
+	for _, key := range readOnly {
+		s.readOnly[key] = struct{}{}
+	}
+	return s
+}
+
+// devicePrefix reports the device prefix of an indexed key like scsi12, keys
+// with an index beyond the pve limit are not treated as devices.
+func (s *guestConfigSchema) devicePrefix(key string) (prefix string, ok bool) {
+	m := regexpConfigDevice.FindStringSubmatch(key)
+	if len(m) < 3 {
+		return
+	}
+	limit, known := s.deviceLimits[m[1]]
+	if !known {
+		return
+	}
+	idx, err := strconv.Atoi(m[2])
+	if nil != err || idx >= limit {
+		return
+	}
+	return m[1], true
+}
+
+// guestConfigDevices is implemented by the configs for the keys with a typed
+// representation other than a scalar field, like disks or nics.
+type guestConfigDevices interface {
+	setDevice(key, value string) (isDevice bool, err error)
+	deviceValue(key string) (value string, isDevice bool, ok bool)
+	delDevice(key string)
+	deviceKeys() []string
+}
+
+// guestConfig is the key based access shared by VirtualMachineConfig and
+// LxcContainerConfig. Every key is kept: scalars in their field, devices by
+// the config itself and everything else verbatim in raw. keys remembers the
+// keys present, so zero values survive a round trip.
+type guestConfig struct {
+	schema  *guestConfigSchema
+	fields  reflect.Value
+	raw     *map[string]string
+	keys    *map[string]struct{}
+	devices guestConfigDevices
+}
+
+// configKey lower cases key, except raw lxc.* container entries
+func configKey(key string) string {
+	if strings.HasPrefix(key, "lxc.") {
+		return key
+	}
+	return strings.ToLower(key)
+}
+
+func (c *guestConfig) unmarshalJSON(b []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	for key, value := range raw {
+		if err := c.setRaw(key, value); err != nil {
+			return fmt.Errorf("config key %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func (c *guestConfig) marshalJSON() ([]byte, error) {
+	data := map[string]interface{}{}
+	for _, key := range c.keyList() {
+		data[key], _ = c.value(key)
+	}
+	return json.Marshal(data)
+}
+
+func (c *guestConfig) setRaw(key string, value json.RawMessage) error {
+	key = configKey(key)
+	if idx, ok := c.schema.scalars[key]; ok {
+		if err := json.Unmarshal(value, c.fields.Field(idx).Addr().Interface()); err != nil {
+			// pve is not consistent in quoting numbers, fall back to the string form
+			return c.set(key, configValueString(value))
+		}
+		c.markKey(key)
+		return nil
+	}
+
+	return c.set(key, configValueString(value))
+}
+
+func (c *guestConfig) set(key string, value string) (err error) {
+	key = configKey(key)
+	if idx, ok := c.schema.scalars[key]; ok {
+		if err = setFieldFromString(c.fields.Field(idx), value); nil != err {
+			return
+		}
+		c.markKey(key)
+		return
+	}
+
+	var isDevice bool
+	if isDevice, err = c.devices.setDevice(key, value); nil != err {
+		return
+	}
+	if !isDevice {
+		if nil == *c.raw {
+			*c.raw = map[string]string{}
+		}
+		(*c.raw)[key] = value
+	}
+	c.markKey(key)
+	return
+}
+
+func (c *guestConfig) get(key string) (value string, ok bool) {
+	v, ok := c.value(configKey(key))
+	if !ok {
+		return
+	}
+	return fmt.Sprintf("%v", v), true
+}
+
+func (c *guestConfig) del(key string) {
+	key = configKey(key)
+	delete(*c.keys, key)
+	delete(*c.raw, key)
+
+	if idx, ok := c.schema.scalars[key]; ok {
+		field := c.fields.Field(idx)
+		field.Set(reflect.Zero(field.Type()))
+		return
+	}
+	c.devices.delDevice(key)
+}
+
+func (c *guestConfig) keyList() (keys []string) {
+	seen := map[string]struct{}{}
+	add := func(key string) {
+		if _, ok := seen[key]; ok {
+			return
+		}
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	}
+
+	for key := range *c.keys {
+		if _, ok := c.value(key); ok {
+			add(key)
+		}
+	}
+	for key, idx := range c.schema.scalars {
+		if !c.fields.Field(idx).IsZero() {
+			add(key)
+		}
+	}
+	for _, key := range c.devices.deviceKeys() {
+		add(key)
+	}
+	for key := range *c.raw {
+		add(key)
+	}
+
+	sort.Strings(keys)
+	return
+}
+
+func (c *guestConfig) options() (options []VirtualMachineOption) {
+	for _, key := range c.keyList() {
+		if _, ok := c.schema.readOnly[key]; ok {
+			continue
+		}
+		value, _ := c.value(key)
+		options = append(options, VirtualMachineOption{Name: key, Value: value})
+	}
+	return
+}
+
+func (c *guestConfig) markKey(key string) {
+	if nil == *c.keys {
+		*c.keys = map[string]struct{}{}
+	}
+	(*c.keys)[key] = struct{}{}
+}
+
+func (c *guestConfig) value(key string) (value interface{}, ok bool) {
+	if idx, isScalar := c.schema.scalars[key]; isScalar {
+		field := c.fields.Field(idx)
+		_, present := (*c.keys)[key]
+		if !present && field.IsZero() {
+			return nil, false
+		}
+		switch f := field.Interface().(type) {
+		case StringOrNumber:
+			return string(f), true
+		case StringOrUint64:
+			return uint64(f), true
+		}
+		return field.Interface(), true
+	}
+
+	if str, isDevice, found := c.devices.deviceValue(key); isDevice {
+		if !found {
+			return nil, false
+		}
+		return str, true
+	}
+
+	value, ok = (*c.raw)[key]
+	return
+}
+
+func configValueString(value json.RawMessage) string {
+	var str string
+	if err := json.Unmarshal(value, &str); nil == err {
+		return str
+	}
+	return strings.TrimSpace(string(value))
+}
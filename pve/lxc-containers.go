@@ -3,49 +3,296 @@ package pve
 import (
 	"fmt"
 	"net/url"
+	"strings"
 )
 
 type LxcContainers []*LxcContainer
 type LxcContainer struct {
-	Name    string
-	Node    string
-	client  *Client
-	CPUs    int
-	Status  string
-	VMID    StringOrUint64
-	Uptime  uint64
-	MaxMem  uint64
-	MaxDisk uint64
-	MaxSwap uint64
+	client             *Client
+	LxcContainerConfig *LxcContainerConfig
+
+	Name      string
+	Node      string
+	CPUs      int
+	CPU       float64
+	Status    string
+	Lock      string `json:",omitempty"`
+	VMID      StringOrUint64
+	Uptime    uint64
+	Mem       uint64
+	MaxMem    uint64
+	Disk      uint64
+	MaxDisk   uint64
+	Swap      uint64
+	MaxSwap   uint64
+	NetIn     uint64
+	NetOut    uint64
+	DiskRead  uint64
+	DiskWrite uint64
+	Tags      string    `json:",omitempty"`
+	Template  IntOrBool `json:",omitempty"`
+	HA        HA        `json:",omitempty"`
+}
+
+func (c *LxcContainer) Ping() error {
+	return c.client.Get(fmt.Sprintf("/nodes/%s/lxc/%d/status/current", c.Node, c.VMID), &c)
+}
+
+func (c *LxcContainer) ConfigLoad(force ...bool) (err error) {
+	if nil == c.LxcContainerConfig || (len(force) > 0 && force[0]) {
+		err = c.client.Get(fmt.Sprintf("/nodes/%s/lxc/%d/config", c.Node, c.VMID), &c.LxcContainerConfig)
+	}
+
+	return
+}
+
+// Config sets options, container config changes apply immediately and run
+// no task.
+func (c *LxcContainer) Config(options ...LxcContainerOption) error {
+	return c.ConfigUpdate("", options...)
+}
+
+// ConfigUpdate posts options guarded by digest, see VirtualMachine.ConfigUpdate.
+func (c *LxcContainer) ConfigUpdate(digest string, options ...LxcContainerOption) error {
+	data := make(map[string]interface{})
+	for _, opt := range options {
+		data[opt.Name] = opt.Value
+	}
+	if "" != digest {
+		data["digest"] = digest
+	}
+	err := c.client.Put(fmt.Sprintf("/nodes/%s/lxc/%d/config", c.Node, c.VMID), data, nil)
+	if isConfigConflict(err) {
+		return &ConfigConflictError{Digest: digest, Err: err}
+	}
+	return err
+}
+
+// ConfigDelete removes keys from the config.
+func (c *LxcContainer) ConfigDelete(keys ...string) error {
+	return c.Config(LxcContainerOption{Name: "delete", Value: strings.Join(keys, ",")})
+}
+
+func (c *LxcContainer) IsRunning() bool {
+	return c.Status == StatusVirtualMachineRunning
+}
+
+func (c *LxcContainer) IsStopped() bool {
+	return c.Status == StatusVirtualMachineStopped
+}
+
+func (c *LxcContainer) status(action string, data interface{}) (task *Task, err error) {
+	var upid string
+	if err = c.client.Post(fmt.Sprintf("/nodes/%s/lxc/%d/status/%s", c.Node, c.VMID, action), data, &upid); err != nil {
+		return nil, err
+	}
+
+	return NewTask(upid, c.client), nil
+}
+
+func (c *LxcContainer) Start() (*Task, error) {
+	return c.status("start", nil)
+}
+
+// Shutdown asks the container init to stop, forceStop kills it after the timeout.
+func (c *LxcContainer) Shutdown(timeout int, forceStop ...bool) (*Task, error) {
+	data := map[string]interface{}{}
+	if timeout > 0 {
+		data["timeout"] = timeout
+	}
+	if len(forceStop) > 0 && forceStop[0] {
+		data["forceStop"] = 1
+	}
+	return c.status("shutdown", data)
+}
+
+func (c *LxcContainer) Stop() (*Task, error) {
+	return c.status("stop", nil)
+}
+
+func (c *LxcContainer) Suspend() (*Task, error) {
+	return c.status("suspend", nil)
+}
+
+func (c *LxcContainer) Reboot() (*Task, error) {
+	return c.status("reboot", nil)
+}
+
+func (c *LxcContainer) Resume() (*Task, error) {
+	return c.status("resume", nil)
+}
+
+// Delete destroys the container, purge also removes it from backup jobs,
+// replication and ha.
+func (c *LxcContainer) Delete(purge ...bool) (task *Task, err error) {
+	p := fmt.Sprintf("/nodes/%s/lxc/%d", c.Node, c.VMID)
+	if len(purge) > 0 && purge[0] {
+		p += "?purge=1"
+	}
+
+	var upid string
+	if err := c.client.Delete(p, &upid); err != nil {
+		return nil, err
+	}
+
+	return NewTask(upid, c.client), nil
+}
+
+type LxcContainerCloneOptions struct {
+	// NewID of the clone, a free id is allocated when 0
+	NewID    int
+	Hostname string
+	Target   string
+	// Full forces a full copy, templates are cloned linked otherwise
+	Full        bool
+	Storage     string
+	Pool        string
+	Description string
+	SnapName    string
+	BWLimit     int // KiB/s
+}
+
+func (o *LxcContainerCloneOptions) params(newid int) map[string]interface{} {
+	data := map[string]interface{}{"newid": newid}
+	if "" != o.Hostname {
+		data["hostname"] = o.Hostname
+	}
+	if "" != o.Target {
+		data["target"] = o.Target
+	}
+	if o.Full {
+		data["full"] = 1
+	}
+	if "" != o.Storage {
+		data["storage"] = o.Storage
+	}
+	if "" != o.Pool {
+		data["pool"] = o.Pool
+	}
+	if "" != o.Description {
+		data["description"] = o.Description
+	}
+	if "" != o.SnapName {
+		data["snapname"] = o.SnapName
+	}
+	if o.BWLimit > 0 {
+		data["bwlimit"] = o.BWLimit
+	}
+	return data
+}
+
+func (c *LxcContainer) Clone(hostname, target string) (newid int, task *Task, err error) {
+	return c.CloneWithOptions(&LxcContainerCloneOptions{Hostname: hostname, Target: target})
+}
+
+func (c *LxcContainer) CloneWithOptions(opts *LxcContainerCloneOptions) (newid int, task *Task, err error) {
+	if nil == opts {
+		opts = &LxcContainerCloneOptions{}
+	}
+
+	var upid string
+	clone := func(id int) error {
+		return c.client.Post(fmt.Sprintf("/nodes/%s/lxc/%d/clone", c.Node, c.VMID), opts.params(id), &upid)
+	}
+
+	newid = opts.NewID
+	if 0 == newid {
+		var cluster *Cluster
+		if cluster, err = c.client.Cluster(); err != nil {
+			return newid, nil, err
+		}
+		newid, err = cluster.AllocateVMID(clone)
+	} else {
+		err = clone(newid)
+	}
+	if err != nil {
+		return newid, nil, err
+	}
+
+	return newid, NewTask(upid, c.client), nil
 }
 
-type LxcContainerStatuses []*LxcContainerStatus
-type LxcContainerStatus struct {
-	Data string `json:",omitempty"`
+// ConvertToTemplate turns the stopped container into a template, pve does
+// this without a task.
+func (c *LxcContainer) ConvertToTemplate() error {
+	return c.client.Post(fmt.Sprintf("/nodes/%s/lxc/%d/template", c.Node, c.VMID), nil, nil)
 }
 
-func (c *LxcContainer) Start() (status string, err error) {
-	return status, c.client.Post(fmt.Sprintf("/nodes/%s/lxc/%d/status/start", c.Node, c.VMID), nil, &status)
+// Resize grows the rootfs or a mpN volume to sizeGb, containers can not shrink.
+func (c *LxcContainer) Resize(volume string, sizeGb int64) (task *Task, err error) {
+	var upid string
+
+	err = c.client.Put(fmt.Sprintf("/nodes/%s/lxc/%d/resize", c.Node, c.VMID), map[string]interface{}{
+		"disk": volume,
+		"size": fmt.Sprintf("%dG", sizeGb),
+	}, &upid)
+	if err != nil {
+		return
+	}
+
+	return NewTask(upid, c.client), nil
 }
 
-func (c *LxcContainer) Stop() (status *LxcContainerStatus, err error) {
-	return status, c.client.Post(fmt.Sprintf("/nodes/%s/lxc/%d/status/stop", c.Node, c.VMID), nil, &status)
+// MoveVolume moves the rootfs or a mpN volume to storage, deleteSource drops
+// the old volume instead of keeping it as unused.
+func (c *LxcContainer) MoveVolume(volume, storage string, deleteSource ...bool) (task *Task, err error) {
+	data := map[string]interface{}{
+		"volume":  volume,
+		"storage": storage,
+	}
+	if len(deleteSource) > 0 && deleteSource[0] {
+		data["delete"] = 1
+	}
+
+	var upid string
+	if err = c.client.Post(fmt.Sprintf("/nodes/%s/lxc/%d/move_volume", c.Node, c.VMID), data, &upid); err != nil {
+		return
+	}
+
+	return NewTask(upid, c.client), nil
 }
 
-func (c *LxcContainer) Suspend() (status *LxcContainerStatus, err error) {
-	return status, c.client.Post(fmt.Sprintf("/nodes/%s/lxc/%d/status/suspend", c.Node, c.VMID), nil, &status)
+type LxcContainerMigrateOptions struct {
+	// Restart migrates a running container by stopping and starting it on the target
+	Restart bool
+	// Timeout for the shutdown of a restart migration in seconds
+	Timeout       int
+	TargetStorage string
+	StorageMap    map[string]string
+	BWLimit       int // KiB/s
 }
 
-func (c *LxcContainer) Reboot() (status *LxcContainerStatus, err error) {
-	return status, c.client.Post(fmt.Sprintf("/nodes/%s/lxc/%d/status/reboot", c.Node, c.VMID), nil, &status)
+func (o *LxcContainerMigrateOptions) params(target string) map[string]interface{} {
+	data := map[string]interface{}{"target": target}
+	if nil == o {
+		return data
+	}
+	if o.Restart {
+		data["restart"] = 1
+	}
+	if o.Timeout > 0 {
+		data["timeout"] = o.Timeout
+	}
+	if targetStorage := idMapping(o.StorageMap, o.TargetStorage); "" != targetStorage {
+		data["target-storage"] = targetStorage
+	}
+	if o.BWLimit > 0 {
+		data["bwlimit"] = o.BWLimit
+	}
+	return data
 }
 
-func (c *LxcContainer) Resume() (status *LxcContainerStatus, err error) {
-	return status, c.client.Post(fmt.Sprintf("/nodes/%s/lxc/%d/status/resume", c.Node, c.VMID), nil, &status)
+func (c *LxcContainer) Migrate(target string, opts *LxcContainerMigrateOptions) (task *Task, err error) {
+	var upid string
+	if err = c.client.Post(fmt.Sprintf("/nodes/%s/lxc/%d/migrate", c.Node, c.VMID), opts.params(target), &upid); err != nil {
+		return nil, err
+	}
+
+	return NewTask(upid, c.client), nil
 }
 
 func (c *LxcContainer) TermProxy() (vnc *VNC, err error) {
-	return vnc, c.client.Post(fmt.Sprintf("/nodes/%s/lxk/%d/termproxy", c.Node, c.VMID), nil, &vnc)
+	return vnc, c.client.Post(fmt.Sprintf("/nodes/%s/lxc/%d/termproxy", c.Node, c.VMID), nil, &vnc)
 }
 
 func (c *LxcContainer) VNCWebSocket(vnc *VNC) (chan string, chan string, chan error, func() error, error) {
@@ -54,3 +301,89 @@ func (c *LxcContainer) VNCWebSocket(vnc *VNC) (chan string, chan string, chan er
 
 	return c.client.VNCWebSocket(p, vnc)
 }
+
+type LxcContainerCreateOptions struct {
+	// VMID of the new container, a free id is allocated when 0
+	VMID int
+	// Config holds the settings, hostname, rootfs, nets, features and so on
+	Config *LxcContainerConfig
+	// Storage and SizeGb create the rootfs when Config has none
+	Storage       string
+	SizeGb        int64
+	Password      string
+	SSHPublicKeys []string
+	Pool          string
+	Start         bool
+}
+
+func (o *LxcContainerCreateOptions) params(tmpl *VzTmpl, vmid int) (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+	if nil != o.Config {
+		for _, option := range o.Config.ToOptions() {
+			data[option.Name] = option.Value
+		}
+	}
+	if _, ok := data["rootfs"]; !ok {
+		if "" == o.Storage || o.SizeGb <= 0 {
+			return nil, fmt.Errorf("container needs a rootfs or storage and size")
+		}
+		data["rootfs"] = fmt.Sprintf("%s:%d", o.Storage, o.SizeGb)
+	}
+	if "" != o.Password {
+		data["password"] = o.Password
+	}
+	if len(o.SSHPublicKeys) > 0 {
+		data["ssh-public-keys"] = strings.Join(o.SSHPublicKeys, "\n")
+	}
+	if "" != o.Pool {
+		data["pool"] = o.Pool
+	}
+	if o.Start {
+		data["start"] = 1
+	}
+	data["ostemplate"] = tmpl.VolID
+	data["vmid"] = vmid
+	return data, nil
+}
+
+// NewLxcContainerFromTemplate creates a container from the os template tmpl
+// through NewLxcContainer and returns the create task with the vmid used.
+func (n *Node) NewLxcContainerFromTemplate(tmpl *VzTmpl, opts *LxcContainerCreateOptions) (task *Task, vmid int, err error) {
+	if nil == tmpl || "" == tmpl.VolID {
+		return nil, 0, fmt.Errorf("template has no volume")
+	}
+	if nil == opts {
+		opts = &LxcContainerCreateOptions{}
+	}
+	if _, err = opts.params(tmpl, 0); nil != err {
+		return
+	}
+
+	create := func(id int) error {
+		data, err := opts.params(tmpl, id)
+		if nil != err {
+			return err
+		}
+		options := make([]LxcContainerOption, 0, len(data))
+		for name, value := range data {
+			options = append(options, LxcContainerOption{Name: name, Value: value})
+		}
+		task, err = n.NewLxcContainer(id, options...)
+		return err
+	}
+
+	vmid = opts.VMID
+	if 0 == vmid {
+		var cluster *Cluster
+		if cluster, err = n.client.Cluster(); nil != err {
+			return nil, 0, err
+		}
+		if vmid, err = cluster.AllocateVMID(create); nil != err {
+			return nil, 0, err
+		}
+	} else if err = create(vmid); nil != err {
+		return nil, vmid, err
+	}
+
+	return task, vmid, nil
+}
@@ -0,0 +1,66 @@
+package pve
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestLxcContainerCloneFailure(t *testing.T) {
+	tests := []struct {
+		name  string
+		newID int
+	}{
+		{name: "allocated vmid"},
+		{name: "explicit vmid", newID: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/cluster/status":
+					writeTestData(w, []interface{}{})
+				case "/cluster/nextid":
+					writeTestData(w, "105")
+				case "/nodes/pve1/lxc/100/clone":
+					http.Error(w, "clone failed", http.StatusInternalServerError)
+				default:
+					http.NotFound(w, r)
+				}
+			})
+
+			ct := &LxcContainer{client: client, Node: "pve1", VMID: 100}
+			_, task, err := ct.CloneWithOptions(&LxcContainerCloneOptions{Hostname: "copy", NewID: tt.newID})
+			if nil == err {
+				t.Fatal("failed clone returned no error")
+			}
+			if nil != task {
+				t.Errorf("failed clone returned task %s", task.UPID)
+			}
+		})
+	}
+}
+
+func TestNewLxcContainerFromTemplateFailure(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cluster/status":
+			writeTestData(w, []interface{}{})
+		case "/cluster/nextid":
+			writeTestData(w, "105")
+		case "/nodes/pve1/lxc":
+			http.Error(w, "create failed", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	node := &Node{client: client, Name: "pve1"}
+	task, _, err := node.NewLxcContainerFromTemplate(&VzTmpl{Content{VolID: "local:vztmpl/debian.tar.zst"}}, &LxcContainerCreateOptions{Storage: "local-lvm", SizeGb: 8})
+	if nil == err {
+		t.Fatal("failed create returned no error")
+	}
+	if nil != task {
+		t.Errorf("failed create returned task %s", task.UPID)
+	}
+}
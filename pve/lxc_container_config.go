@@ -0,0 +1,384 @@
+package pve
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// LxcContainerOption is a name and value posted to the container endpoints.
+type LxcContainerOption = VirtualMachineOption
+
+// indexed container config keys and the number of slots pve allows
+var lxcConfigDeviceLimits = map[string]int{
+	"mp":     256,
+	"unused": 256,
+	"net":    32,
+	"dev":    256,
+}
+
+// keys returned by the config endpoint that can not be posted back, lxc
+// holds the raw lxc.* lines which pve only accepts from the config file
+var lxcConfigSchema = newGuestConfigSchema(LxcContainerConfig{}, lxcConfigDeviceLimits,
+	"digest", "lock", "parent", "snaptime", "lxc")
+
+// LxcMountPoint is the rootfs or a mpN option.
+type LxcMountPoint struct {
+	propertyStringState
+	Name         string            `json:"name,omitempty"`
+	Volume       string            `json:"volume,omitempty" pve:"volume,default"`
+	Path         string            `json:"mp,omitempty" pve:"mp"`
+	Size         string            `json:"size,omitempty" pve:"size"`
+	ACL          int               `json:"acl,omitempty" pve:"acl"`
+	Backup       int               `json:"backup,omitempty" pve:"backup"`
+	Quota        int               `json:"quota,omitempty" pve:"quota"`
+	Replicate    int               `json:"replicate,omitempty" pve:"replicate"`
+	ReadOnly     int               `json:"ro,omitempty" pve:"ro"`
+	Shared       int               `json:"shared,omitempty" pve:"shared"`
+	MountOptions string            `json:"mountoptions,omitempty" pve:"mountoptions"`
+	Extra        map[string]string `json:"extra,omitempty" pve:",extra"`
+}
+
+func (mp *LxcMountPoint) Parse(conf string) error {
+	name := mp.Name
+	*mp = LxcMountPoint{Name: name}
+	return UnmarshalPropertyString(conf, mp)
+}
+
+// Storage returns the storage of a volume like local-lvm:vm-100-disk-0, empty
+// for bind mounts.
+func (mp *LxcMountPoint) Storage() string {
+	if strings.HasPrefix(mp.Volume, "/") {
+		return ""
+	}
+	storage, _, _ := strings.Cut(mp.Volume, ":")
+	return storage
+}
+
+func (mp *LxcMountPoint) String() string {
+	str, _ := MarshalPropertyString(mp)
+	return str
+}
+
+type LxcFeatures struct {
+	propertyStringState
+	Nesting    int               `json:"nesting,omitempty" pve:"nesting"`
+	KeyCtl     int               `json:"keyctl,omitempty" pve:"keyctl"`
+	Fuse       int               `json:"fuse,omitempty" pve:"fuse"`
+	Mknod      int               `json:"mknod,omitempty" pve:"mknod"`
+	ForceRWSys int               `json:"force_rw_sys,omitempty" pve:"force_rw_sys"`
+	Mount      string            `json:"mount,omitempty" pve:"mount"` // allowed filesystems separated by ;
+	Extra      map[string]string `json:"extra,omitempty" pve:",extra"`
+}
+
+func (f *LxcFeatures) String() string {
+	str, _ := MarshalPropertyString(f)
+	return str
+}
+
+// LxcNetwork is a netN option of a container, Device is the config key like
+// net0 while Name is the interface name inside the container.
+type LxcNetwork struct {
+	propertyStringState
+	Device   string            `json:"device,omitempty"`
+	Name     string            `json:"name,omitempty" pve:"name"`
+	Bridge   string            `json:"bridge,omitempty" pve:"bridge"`
+	HWAddr   string            `json:"hwaddr,omitempty" pve:"hwaddr"`
+	IP       string            `json:"ip,omitempty" pve:"ip"`
+	GW       string            `json:"gw,omitempty" pve:"gw"`
+	IP6      string            `json:"ip6,omitempty" pve:"ip6"`
+	GW6      string            `json:"gw6,omitempty" pve:"gw6"`
+	Tag      int               `json:"tag,omitempty" pve:"tag"`
+	Trunks   string            `json:"trunks,omitempty" pve:"trunks"`
+	Firewall int               `json:"firewall,omitempty" pve:"firewall"`
+	LinkDown int               `json:"link_down,omitempty" pve:"link_down"`
+	MTU      int               `json:"mtu,omitempty" pve:"mtu"`
+	Rate     float64           `json:"rate,omitempty" pve:"rate"`
+	Type     string            `json:"type,omitempty" pve:"type"`
+	Extra    map[string]string `json:"extra,omitempty" pve:",extra"`
+}
+
+// Parse reads a netN option like "name=eth0,bridge=vmbr0,ip=dhcp,type=veth".
+func (n *LxcNetwork) Parse(conf string) error {
+	device := n.Device
+	*n = LxcNetwork{Device: device}
+	return UnmarshalPropertyString(conf, n)
+}
+
+func (n *LxcNetwork) String() string {
+	str, _ := MarshalPropertyString(n)
+	return str
+}
+
+type LxcContainerConfig struct {
+	Hostname     string         `json:"hostname,omitempty"`
+	Description  string         `json:"description,omitempty"`
+	Tags         string         `json:"tags,omitempty"`
+	OSType       string         `json:"ostype,omitempty"`
+	Arch         string         `json:"arch,omitempty"`
+	Cores        int            `json:"cores,omitempty"`
+	CPULimit     StringOrNumber `json:"cpulimit,omitempty"`
+	CPUUnits     int            `json:"cpuunits,omitempty"`
+	Memory       StringOrUint64 `json:"memory,omitempty"`
+	Swap         StringOrUint64 `json:"swap,omitempty"`
+	OnBoot       int            `json:"onboot,omitempty"`
+	Startup      string         `json:"startup,omitempty"`
+	Protection   int            `json:"protection,omitempty"`
+	Unprivileged int            `json:"unprivileged,omitempty"`
+	Template     int            `json:"template,omitempty"`
+	Hookscript   string         `json:"hookscript,omitempty"`
+	Nameserver   string         `json:"nameserver,omitempty"`
+	Searchdomain string         `json:"searchdomain,omitempty"`
+	Timezone     string         `json:"timezone,omitempty"`
+	Console      int            `json:"console,omitempty"`
+	CMode        string         `json:"cmode,omitempty"`
+	TTY          int            `json:"tty,omitempty"`
+	Entrypoint   string         `json:"entrypoint,omitempty"`
+	Env          string         `json:"env,omitempty"`
+
+	Digest string `json:"digest,omitempty"`
+	Lock   string `json:"lock,omitempty"`
+	Parent string `json:"parent,omitempty"`
+
+	RootFS      *LxcMountPoint            `json:"-"`
+	MountPoints map[string]*LxcMountPoint `json:"-"`
+	Features    *LxcFeatures              `json:"-"`
+	Nets        map[string]*LxcNetwork    `json:"-"`
+	Unuseds     map[string]string         `json:"-"`
+	Devs        map[string]string         `json:"-"`
+
+	// Raw holds every key this model has no field for, like lxc.* entries
+	Raw map[string]string `json:"-"`
+
+	keys map[string]struct{}
+}
+
+func (lc *LxcContainerConfig) config() *guestConfig {
+	return &guestConfig{
+		schema:  lxcConfigSchema,
+		fields:  reflect.ValueOf(lc).Elem(),
+		raw:     &lc.Raw,
+		keys:    &lc.keys,
+		devices: lc,
+	}
+}
+
+func (lc *LxcContainerConfig) UnmarshalJSON(b []byte) error {
+	*lc = LxcContainerConfig{}
+	return lc.config().unmarshalJSON(b)
+}
+
+func (lc *LxcContainerConfig) MarshalJSON() ([]byte, error) {
+	return lc.config().marshalJSON()
+}
+
+// Set parses value into the typed field for key, keys without a typed
+// representation are kept in Raw.
+func (lc *LxcContainerConfig) Set(key string, value string) error {
+	return lc.config().set(key, value)
+}
+
+// Get returns the option string pve expects for key.
+func (lc *LxcContainerConfig) Get(key string) (value string, ok bool) {
+	return lc.config().get(key)
+}
+
+func (lc *LxcContainerConfig) Del(key string) {
+	lc.config().del(key)
+}
+
+// Keys lists every key set in this config, sorted.
+func (lc *LxcContainerConfig) Keys() []string {
+	return lc.config().keyList()
+}
+
+// ToOptions converts the config back into the options accepted by
+// LxcContainer.Config, leaving out read-only keys like digest or lock and
+// the raw lxc.* entries.
+func (lc *LxcContainerConfig) ToOptions() []LxcContainerOption {
+	return lc.config().options()
+}
+
+// MountPoint returns rootfs or a mpN mount point.
+func (lc *LxcContainerConfig) MountPoint(name string) *LxcMountPoint {
+	name = strings.ToLower(name)
+	if "rootfs" == name {
+		return lc.RootFS
+	}
+	return lc.MountPoints[name]
+}
+
+func (lc *LxcContainerConfig) SetMountPoint(name string, mp *LxcMountPoint) error {
+	name = strings.ToLower(name)
+	if prefix, ok := lxcConfigSchema.devicePrefix(name); "rootfs" != name && (!ok || "mp" != prefix) {
+		return fmt.Errorf("invalid mount point name %s", name)
+	}
+	mp.Name = name
+	if "rootfs" == name {
+		lc.RootFS = mp
+	} else {
+		if nil == lc.MountPoints {
+			lc.MountPoints = map[string]*LxcMountPoint{}
+		}
+		lc.MountPoints[name] = mp
+	}
+	lc.config().markKey(name)
+	return nil
+}
+
+func (lc *LxcContainerConfig) Net(name string) *LxcNetwork {
+	return lc.Nets[strings.ToLower(name)]
+}
+
+func (lc *LxcContainerConfig) SetNet(name string, net *LxcNetwork) error {
+	name = strings.ToLower(name)
+	if prefix, ok := lxcConfigSchema.devicePrefix(name); !ok || "net" != prefix {
+		return fmt.Errorf("invalid network name %s", name)
+	}
+	net.Device = name
+	if nil == lc.Nets {
+		lc.Nets = map[string]*LxcNetwork{}
+	}
+	lc.Nets[name] = net
+	lc.config().markKey(name)
+	return nil
+}
+
+func (lc *LxcContainerConfig) setDevice(key, value string) (isDevice bool, err error) {
+	switch key {
+	case "rootfs":
+		mp := &LxcMountPoint{Name: key}
+		if err = mp.Parse(value); nil != err {
+			return true, err
+		}
+		lc.RootFS = mp
+		return true, nil
+	case "features":
+		features := &LxcFeatures{}
+		if err = UnmarshalPropertyString(value, features); nil != err {
+			return true, err
+		}
+		lc.Features = features
+		return true, nil
+	}
+
+	prefix, isDevice := lxcConfigSchema.devicePrefix(key)
+	if !isDevice {
+		return
+	}
+	switch prefix {
+	case "mp":
+		mp := &LxcMountPoint{Name: key}
+		if err = mp.Parse(value); nil != err {
+			return
+		}
+		if nil == lc.MountPoints {
+			lc.MountPoints = map[string]*LxcMountPoint{}
+		}
+		lc.MountPoints[key] = mp
+	case "net":
+		net := &LxcNetwork{Device: key}
+		if err = net.Parse(value); nil != err {
+			return
+		}
+		if nil == lc.Nets {
+			lc.Nets = map[string]*LxcNetwork{}
+		}
+		lc.Nets[key] = net
+	default:
+		strs := lc.stringMap(prefix)
+		if nil == *strs {
+			*strs = map[string]string{}
+		}
+		(*strs)[key] = value
+	}
+	return
+}
+
+func (lc *LxcContainerConfig) deviceValue(key string) (value string, isDevice bool, ok bool) {
+	switch key {
+	case "rootfs":
+		if nil != lc.RootFS {
+			return lc.RootFS.String(), true, true
+		}
+		return "", true, false
+	case "features":
+		if nil != lc.Features {
+			return lc.Features.String(), true, true
+		}
+		return "", true, false
+	}
+
+	prefix, isDevice := lxcConfigSchema.devicePrefix(key)
+	if !isDevice {
+		return
+	}
+	switch prefix {
+	case "mp":
+		if mp, found := lc.MountPoints[key]; found && nil != mp {
+			return mp.String(), true, true
+		}
+		return "", true, false
+	case "net":
+		if net, found := lc.Nets[key]; found && nil != net {
+			return net.String(), true, true
+		}
+		return "", true, false
+	}
+	value, ok = (*lc.stringMap(prefix))[key]
+	return value, true, ok
+}
+
+func (lc *LxcContainerConfig) delDevice(key string) {
+	switch key {
+	case "rootfs":
+		lc.RootFS = nil
+		return
+	case "features":
+		lc.Features = nil
+		return
+	}
+	if prefix, ok := lxcConfigSchema.devicePrefix(key); ok {
+		switch prefix {
+		case "mp":
+			delete(lc.MountPoints, key)
+		case "net":
+			delete(lc.Nets, key)
+		default:
+			delete(*lc.stringMap(prefix), key)
+		}
+	}
+}
+
+func (lc *LxcContainerConfig) deviceKeys() (keys []string) {
+	if nil != lc.RootFS {
+		keys = append(keys, "rootfs")
+	}
+	if nil != lc.Features {
+		keys = append(keys, "features")
+	}
+	for key, mp := range lc.MountPoints {
+		if nil != mp {
+			keys = append(keys, key)
+		}
+	}
+	for key, net := range lc.Nets {
+		if nil != net {
+			keys = append(keys, key)
+		}
+	}
+	for _, m := range []map[string]string{lc.Unuseds, lc.Devs} {
+		for key := range m {
+			keys = append(keys, key)
+		}
+	}
+	return
+}
+
+func (lc *LxcContainerConfig) stringMap(prefix string) *map[string]string {
+	switch prefix {
+	case "unused":
+		return &lc.Unuseds
+	}
+	return &lc.Devs
+}
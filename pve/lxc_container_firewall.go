@@ -0,0 +1,80 @@
+package pve
+
+import (
+	"fmt"
+	"net/url"
+)
+
+func (c *LxcContainer) FirewallOptionGet() (firewallOption *FirewallVirtualMachineOption, err error) {
+	err = c.client.Get(fmt.Sprintf("/nodes/%s/lxc/%d/firewall/options", c.Node, c.VMID), &firewallOption)
+	return
+}
+func (c *LxcContainer) FirewallOptionSet(firewallOption *FirewallVirtualMachineOption) (err error) {
+	err = c.client.Put(fmt.Sprintf("/nodes/%s/lxc/%d/firewall/options", c.Node, c.VMID), firewallOption, nil)
+	return
+}
+
+func (c *LxcContainer) FirewallGetRules() (rules []*FirewallRule, err error) {
+	err = c.client.Get(fmt.Sprintf("/nodes/%s/lxc/%d/firewall/rules", c.Node, c.VMID), &rules)
+	return
+}
+
+func (c *LxcContainer) FirewallRulesCreate(rule *FirewallRule) (err error) {
+	err = c.client.Post(fmt.Sprintf("/nodes/%s/lxc/%d/firewall/rules", c.Node, c.VMID), rule, nil)
+	return
+}
+func (c *LxcContainer) FirewallRulesUpdate(rule *FirewallRule) (err error) {
+	err = c.client.Put(fmt.Sprintf("/nodes/%s/lxc/%d/firewall/rules/%d", c.Node, c.VMID, rule.Pos), rule, nil)
+	return
+}
+func (c *LxcContainer) FirewallRulesDelete(rulePos int) (err error) {
+	err = c.client.Delete(fmt.Sprintf("/nodes/%s/lxc/%d/firewall/rules/%d", c.Node, c.VMID, rulePos), nil)
+	return
+}
+
+func (c *LxcContainer) FirewallIPSets() (ipSets []*FirewallIPSet, err error) {
+	err = c.client.Get(fmt.Sprintf("/nodes/%s/lxc/%d/firewall/ipset", c.Node, c.VMID), &ipSets)
+	return
+}
+func (c *LxcContainer) FirewallIPSetCreate(ipSet *FirewallIPSet) (err error) {
+	err = c.client.Post(fmt.Sprintf("/nodes/%s/lxc/%d/firewall/ipset", c.Node, c.VMID), ipSet, nil)
+	return
+}
+func (c *LxcContainer) FirewallIPSetDelete(name string) (err error) {
+	err = c.client.Delete(fmt.Sprintf("/nodes/%s/lxc/%d/firewall/ipset/%s", c.Node, c.VMID, name), nil)
+	return
+}
+
+func (c *LxcContainer) FirewallIPSetEntries(name string) (entries []*FirewallIPSetEntry, err error) {
+	err = c.client.Get(fmt.Sprintf("/nodes/%s/lxc/%d/firewall/ipset/%s", c.Node, c.VMID, name), &entries)
+	return
+}
+func (c *LxcContainer) FirewallIPSetEntryAdd(name string, entry *FirewallIPSetEntry) (err error) {
+	err = c.client.Post(fmt.Sprintf("/nodes/%s/lxc/%d/firewall/ipset/%s", c.Node, c.VMID, name), entry, nil)
+	return
+}
+func (c *LxcContainer) FirewallIPSetEntryUpdate(name string, entry *FirewallIPSetEntry) (err error) {
+	err = c.client.Put(fmt.Sprintf("/nodes/%s/lxc/%d/firewall/ipset/%s/%s", c.Node, c.VMID, name, url.PathEscape(entry.CIDR)), entry, nil)
+	return
+}
+func (c *LxcContainer) FirewallIPSetEntryDelete(name, cidr string) (err error) {
+	err = c.client.Delete(fmt.Sprintf("/nodes/%s/lxc/%d/firewall/ipset/%s/%s", c.Node, c.VMID, name, url.PathEscape(cidr)), nil)
+	return
+}
+
+func (c *LxcContainer) FirewallAliases() (aliases []*FirewallAlias, err error) {
+	err = c.client.Get(fmt.Sprintf("/nodes/%s/lxc/%d/firewall/aliases", c.Node, c.VMID), &aliases)
+	return
+}
+func (c *LxcContainer) FirewallAliasCreate(alias *FirewallAlias) (err error) {
+	err = c.client.Post(fmt.Sprintf("/nodes/%s/lxc/%d/firewall/aliases", c.Node, c.VMID), alias, nil)
+	return
+}
+func (c *LxcContainer) FirewallAliasUpdate(alias *FirewallAlias) (err error) {
+	err = c.client.Put(fmt.Sprintf("/nodes/%s/lxc/%d/firewall/aliases/%s", c.Node, c.VMID, alias.Name), alias, nil)
+	return
+}
+func (c *LxcContainer) FirewallAliasDelete(name string) (err error) {
+	err = c.client.Delete(fmt.Sprintf("/nodes/%s/lxc/%d/firewall/aliases/%s", c.Node, c.VMID, name), nil)
+	return
+}
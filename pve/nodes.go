@@ -45,6 +45,10 @@ type Node struct {
 	Ksm        Ksm
 	Uptime     uint64
 	Wait       float64
+
+	// only filled from the cluster resources, the status endpoint has neither
+	Status string `json:",omitempty"`
+	Level  string `json:",omitempty"`
 }
 
 func (c *Client) Nodes() (ns NodeStatuses, err error) {
@@ -137,6 +141,23 @@ func (n *Node) LxcContainers() (c LxcContainers, err error) {
 	return c, nil
 }
 
+// NewLxcContainer creates container id from options as they are posted, see
+// NewLxcContainerFromTemplate for typed options and vmid allocation.
+func (n *Node) NewLxcContainer(id int, options ...LxcContainerOption) (*Task, error) {
+	var upid string
+	data := make(map[string]interface{})
+	data["vmid"] = id
+
+	for _, option := range options {
+		data[option.Name] = option.Value
+	}
+
+	err := n.client.Post(fmt.Sprintf("/nodes/%s/lxc", n.Name), data, &upid)
+	return NewTask(upid, n.client), err
+}
+
+// LxcContainer returns the status of container id, the config needs
+// VM.Audit and is only read by ConfigLoad.
 func (n *Node) LxcContainer(id int) (*LxcContainer, error) {
 	var c LxcContainer
 	if err := n.client.Get(fmt.Sprintf("/nodes/%s/lxc/%d/status/current", n.Name, id), &c); err != nil {
@@ -0,0 +1,305 @@
+package pve
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Property strings are the comma separated key=value lists pve uses for
+// composite options like disks, nics or the agent settings. The schema of a
+// property string is described with `pve` struct tags:
+//
+//	File  string            `pve:"file,default"` // value allowed without key, emitted first
+//	Cache string            `pve:"cache"`
+//	Extra map[string]string `pve:",extra"`       // keys without a field
+//
+// Types embedding propertyStringState remember which keys were present and
+// in which order, so explicit zero values like backup=0 survive a round trip.
+
+type propertyStringField struct {
+	key       string
+	index     []int
+	isDefault bool
+}
+
+type propertyStringSchema struct {
+	fields     []*propertyStringField
+	byKey      map[string]*propertyStringField
+	defaultKey string
+	extra      []int
+}
+
+type propertyStringTracker interface {
+	markPropertyPresent(key string)
+	isPropertyPresent(key string) bool
+	propertyOrder() []string
+}
+
+type propertyStringState struct {
+	present map[string]struct{}
+	order   []string
+}
+
+func (s *propertyStringState) markPropertyPresent(key string) {
+	if nil == s.present {
+		s.present = map[string]struct{}{}
+	}
+	if _, ok := s.present[key]; !ok {
+		s.order = append(s.order, key)
+	}
+	s.present[key] = struct{}{}
+}
+
+func (s *propertyStringState) isPropertyPresent(key string) bool {
+	_, ok := s.present[key]
+	return ok
+}
+
+func (s *propertyStringState) propertyOrder() []string {
+	return s.order
+}
+
+var propertyStringSchemas sync.Map
+
+func getPropertyStringSchema(t reflect.Type) *propertyStringSchema {
+	if cached, ok := propertyStringSchemas.Load(t); ok {
+		return cached.(*propertyStringSchema)
+	}
+
+	schema := &propertyStringSchema{byKey: map[string]*propertyStringField{}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("pve")
+		if !ok || "-" == tag || !f.IsExported() {
+			continue
+		}
+
+		parts := strings.Split(tag, ",")
+		field := &propertyStringField{key: parts[0], index: f.Index}
+		for _, opt := range parts[1:] {
+			switch opt {
+			case "default":
+				field.isDefault = true
+				schema.defaultKey = field.key
+			case "extra":
+				schema.extra = f.Index
+			}
+		}
+		if "" == field.key {
+			continue
+		}
+		schema.fields = append(schema.fields, field)
+		schema.byKey[field.key] = field
+	}
+
+	propertyStringSchemas.Store(t, schema)
+	return schema
+}
+
+// SplitPropertyString splits a property string into its items, empty items
+// are dropped.
+func SplitPropertyString(s string) (items []string) {
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); "" != item {
+			items = append(items, item)
+		}
+	}
+	return
+}
+
+// UnmarshalPropertyString decodes s into the struct pointed to by v using its
+// `pve` tags.
+func UnmarshalPropertyString(s string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("property string target must be a pointer to a struct, got %T", v)
+	}
+	rv = rv.Elem()
+	schema := getPropertyStringSchema(rv.Type())
+	tracker, _ := v.(propertyStringTracker)
+
+	for _, item := range SplitPropertyString(s) {
+		key, value, hasKey := strings.Cut(item, "=")
+		if !hasKey {
+			if "" == schema.defaultKey {
+				return fmt.Errorf("property string %q: value %q has no key", s, item)
+			}
+			key, value = schema.defaultKey, item
+		}
+
+		field, ok := schema.byKey[key]
+		if !ok {
+			if nil == schema.extra {
+				return fmt.Errorf("property string %q: unknown key %s", s, key)
+			}
+			extra := rv.FieldByIndex(schema.extra)
+			if extra.IsNil() {
+				extra.Set(reflect.MakeMap(extra.Type()))
+			}
+			extra.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(value))
+			if nil != tracker {
+				tracker.markPropertyPresent(key)
+			}
+			continue
+		}
+
+		if err := setFieldFromString(rv.FieldByIndex(field.index), value); nil != err {
+			return fmt.Errorf("property string %q: key %s: %w", s, key, err)
+		}
+		if nil != tracker {
+			tracker.markPropertyPresent(key)
+		}
+	}
+
+	return nil
+}
+
+// MarshalPropertyString encodes the struct v into a property string. Keys
+// read by UnmarshalPropertyString keep their original order, other fields
+// follow in declaration order and remaining extra keys sorted by name.
+func MarshalPropertyString(v interface{}) (string, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return "", fmt.Errorf("property string source must be a struct, got %T", v)
+	}
+	schema := getPropertyStringSchema(rv.Type())
+	tracker, _ := v.(propertyStringTracker)
+
+	var extra reflect.Value
+	var extraKeys []string
+	if nil != schema.extra {
+		extra = rv.FieldByIndex(schema.extra)
+		for _, k := range extra.MapKeys() {
+			extraKeys = append(extraKeys, k.String())
+		}
+		sort.Strings(extraKeys)
+	}
+
+	var items []string
+	emitted := map[string]struct{}{}
+	emit := func(key string) error {
+		if _, ok := emitted[key]; ok {
+			return nil
+		}
+		emitted[key] = struct{}{}
+
+		field, ok := schema.byKey[key]
+		if !ok {
+			if !extra.IsValid() {
+				return nil
+			}
+			value := extra.MapIndex(reflect.ValueOf(key))
+			if value.IsValid() {
+				items = append(items, fmt.Sprintf("%s=%s", key, value.String()))
+			}
+			return nil
+		}
+
+		fv := rv.FieldByIndex(field.index)
+		// explicit zeros are kept for numbers only, an empty string means unset
+		if fv.IsZero() && (reflect.String == fv.Kind() || nil == tracker || !tracker.isPropertyPresent(key)) {
+			return nil
+		}
+		value, err := formatFieldString(fv)
+		if nil != err {
+			return fmt.Errorf("property %s: %w", key, err)
+		}
+		if field.isDefault {
+			items = append([]string{value}, items...)
+			return nil
+		}
+		items = append(items, fmt.Sprintf("%s=%s", key, value))
+		return nil
+	}
+
+	var keys []string
+	if nil != tracker {
+		keys = append(keys, tracker.propertyOrder()...)
+	}
+	for _, field := range schema.fields {
+		keys = append(keys, field.key)
+	}
+	keys = append(keys, extraKeys...)
+	for _, key := range keys {
+		if err := emit(key); nil != err {
+			return "", err
+		}
+	}
+
+	return strings.Join(items, ","), nil
+}
+
+func setFieldFromString(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		switch strings.ToLower(value) {
+		case "1", "on", "yes", "true":
+			field.SetBool(true)
+		case "", "0", "off", "no", "false":
+			field.SetBool(false)
+		default:
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if "" == value {
+			field.SetInt(0)
+			return nil
+		}
+		i, err := strconv.ParseInt(value, 10, 64)
+		if nil != err {
+			return err
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if "" == value {
+			field.SetUint(0)
+			return nil
+		}
+		u, err := strconv.ParseUint(value, 10, 64)
+		if nil != err {
+			return err
+		}
+		field.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		if "" == value {
+			field.SetFloat(0)
+			return nil
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if nil != err {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+func formatFieldString(field reflect.Value) (string, error) {
+	switch field.Kind() {
+	case reflect.String:
+		return field.String(), nil
+	case reflect.Bool:
+		if field.Bool() {
+			return "1", nil
+		}
+		return "0", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(field.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(field.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(field.Float(), 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("unsupported field type %s", field.Type())
+}
@@ -0,0 +1,160 @@
+package pve
+
+import (
+	"testing"
+)
+
+func TestVirtualMachineDiskRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		out  string // in when empty
+	}{
+		{name: "plain", in: "local-lvm:vm-100-disk-0,iothread=1,size=32G"},
+		{name: "explicit zero", in: "local-lvm:vm-100-disk-0,backup=0,replicate=0,size=8G"},
+		{name: "throttle", in: "local-lvm:vm-100-disk-0,mbps=10.5,mbps_rd_max=20,iops=500,iops_wr_max=1000,iops_wr_max_length=60"},
+		{name: "identity", in: "local:100/vm-100-disk-0.qcow2,serial=ABC123,wwn=0x5000c500a1b2c3d4,model=QEMU"},
+		{name: "import", in: "local-lvm:0,import-from=local:iso/debian.qcow2,discard=on"},
+		{name: "path volume", in: "/dev/disk/by-id/ata-disk,backup=0"},
+		{name: "cdrom", in: "none,media=cdrom"},
+		{name: "sub gigabyte size", in: "local-lvm:vm-100-disk-1,size=1536M"},
+		{name: "unknown keys", in: "local-lvm:vm-100-disk-0,size=4G,newopt=x,another=1"},
+		{name: "decimal uint", in: "local-lvm:vm-100-disk-0,iops=010", out: "local-lvm:vm-100-disk-0,iops=10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.out
+			if "" == want {
+				want = tt.in
+			}
+			disk := &VirtualMachineDisk{}
+			if err := disk.Parse(tt.in); nil != err {
+				t.Fatalf("parse %q: %s", tt.in, err)
+			}
+			if got := disk.String(); got != want {
+				t.Errorf("round trip of %q\n got %q\nwant %q", tt.in, got, want)
+			}
+		})
+	}
+}
+
+func TestVirtualMachineDiskFields(t *testing.T) {
+	disk := &VirtualMachineDisk{}
+	if err := disk.Parse("local-lvm:vm-100-disk-0,mbps=10.5,iops=010,serial=ABC,wwn=0x5000c500,import-from=local:iso/a.img,size=32G"); nil != err {
+		t.Fatal(err)
+	}
+	if "local-lvm" != disk.Storage || "vm-100-disk-0" != disk.File {
+		t.Errorf("volume split into %q and %q", disk.Storage, disk.File)
+	}
+	if 10.5 != disk.Mbps || 10 != disk.Iops || "ABC" != disk.Serial || "0x5000c500" != disk.Wwn || "local:iso/a.img" != disk.ImportFrom {
+		t.Errorf("unexpected fields %+v", disk)
+	}
+	if 32 != disk.SizeGb {
+		t.Errorf("size %d, want 32", disk.SizeGb)
+	}
+
+	disk.SizeGb = 40
+	if got, want := disk.String(), "local-lvm:vm-100-disk-0,mbps=10.5,iops=10,serial=ABC,wwn=0x5000c500,import-from=local:iso/a.img,size=40G"; got != want {
+		t.Errorf("changed size\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestVirtualMachineNetworkRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		out  string
+	}{
+		{name: "plain", in: "virtio=BC:24:11:00:00:01,bridge=vmbr0,firewall=1"},
+		{name: "options", in: "virtio=BC:24:11:00:00:01,bridge=vmbr0,mtu=1400,tag=20,rate=12.5,link_down=1"},
+		{name: "explicit zero", in: "e1000=BC:24:11:00:00:02,bridge=vmbr1,firewall=0,link_down=0"},
+		{name: "model and macaddr", in: "model=virtio,macaddr=BC:24:11:00:00:03,bridge=vmbr0", out: "virtio=BC:24:11:00:00:03,bridge=vmbr0"},
+		{name: "unknown keys", in: "virtio=BC:24:11:00:00:04,bridge=vmbr0,newopt=x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.out
+			if "" == want {
+				want = tt.in
+			}
+			nic := &VirtualMachineNetwork{}
+			if err := nic.Parse(tt.in); nil != err {
+				t.Fatalf("parse %q: %s", tt.in, err)
+			}
+			if got := nic.String(); got != want {
+				t.Errorf("round trip of %q\n got %q\nwant %q", tt.in, got, want)
+			}
+		})
+	}
+}
+
+func TestVirtualMachineNetworkFields(t *testing.T) {
+	nic := &VirtualMachineNetwork{}
+	if err := nic.Parse("virtio=BC:24:11:00:00:01,bridge=vmbr0,mtu=1400,tag=20,rate=12.5,link_down=1,newopt=x"); nil != err {
+		t.Fatal(err)
+	}
+	if "virtio" != nic.Type || "BC:24:11:00:00:01" != nic.Mac || "vmbr0" != nic.Bridge {
+		t.Errorf("unexpected model %+v", nic)
+	}
+	if 1400 != nic.Mtu || 20 != nic.Tag || 12.5 != nic.Rate || 1 != nic.LinkDown {
+		t.Errorf("unexpected options %+v", nic)
+	}
+	if "x" != nic.Extra["newopt"] {
+		t.Errorf("unknown key lost, extra %v", nic.Extra)
+	}
+}
+
+func TestPropertyStringUnknownKeyWithoutExtra(t *testing.T) {
+	var v struct {
+		Cache string `pve:"cache"`
+	}
+	if err := UnmarshalPropertyString("cache=none,foo=bar", &v); nil == err {
+		t.Error("unknown key accepted without extra field")
+	}
+}
+
+func TestLxcNetworkRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{name: "dhcp", in: "name=eth0,bridge=vmbr0,hwaddr=BC:24:11:00:00:01,ip=dhcp,type=veth"},
+		{name: "static", in: "name=eth0,bridge=vmbr0,ip=10.0.0.5/24,gw=10.0.0.1,ip6=auto,type=veth"},
+		{name: "options", in: "name=eth1,bridge=vmbr1,tag=20,trunks=20;30,firewall=1,mtu=1400,rate=12.5,type=veth"},
+		{name: "explicit zero", in: "name=eth0,bridge=vmbr0,firewall=0,link_down=0,type=veth"},
+		{name: "unknown keys", in: "name=eth0,bridge=vmbr0,type=veth,newopt=x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			net := &LxcNetwork{Device: "net0"}
+			if err := net.Parse(tt.in); nil != err {
+				t.Fatalf("parse %q: %s", tt.in, err)
+			}
+			if "net0" != net.Device {
+				t.Errorf("device %q, want net0", net.Device)
+			}
+			if got := net.String(); got != tt.in {
+				t.Errorf("round trip of %q\n got %q\nwant %q", tt.in, got, tt.in)
+			}
+		})
+	}
+}
+
+func TestLxcNetworkFields(t *testing.T) {
+	net := &LxcNetwork{}
+	if err := net.Parse("name=eth0,bridge=vmbr0,ip=10.0.0.5/24,gw=10.0.0.1,tag=20,mtu=1400,rate=12.5,link_down=1,newopt=x"); nil != err {
+		t.Fatal(err)
+	}
+	if "eth0" != net.Name || "vmbr0" != net.Bridge || "10.0.0.5/24" != net.IP || "10.0.0.1" != net.GW {
+		t.Errorf("unexpected addressing %+v", net)
+	}
+	if 20 != net.Tag || 1400 != net.MTU || 12.5 != net.Rate || 1 != net.LinkDown {
+		t.Errorf("unexpected options %+v", net)
+	}
+	if "x" != net.Extra["newopt"] {
+		t.Errorf("unknown key lost, extra %v", net.Extra)
+	}
+}
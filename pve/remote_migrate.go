@@ -0,0 +1,130 @@
+package pve
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RemoteEndpoint describes the api of the target cluster for remote
+// migrations, Fingerprint is required for self signed certificates.
+type RemoteEndpoint struct {
+	propertyStringState
+	Host        string            `json:"host" pve:"host"`
+	APIToken    string            `json:"apitoken" pve:"apitoken"`
+	Fingerprint string            `json:"fingerprint,omitempty" pve:"fingerprint"`
+	Port        int               `json:"port,omitempty" pve:"port"`
+	Extra       map[string]string `json:"extra,omitempty" pve:",extra"`
+}
+
+func NewRemoteEndpoint(host, tokenID, secret, fingerprint string) *RemoteEndpoint {
+	return &RemoteEndpoint{
+		Host:        host,
+		APIToken:    fmt.Sprintf("PVEAPIToken=%s=%s", tokenID, secret),
+		Fingerprint: fingerprint,
+	}
+}
+
+func (e *RemoteEndpoint) String() string {
+	str, _ := MarshalPropertyString(e)
+	return str
+}
+
+type RemoteMigrateOptions struct {
+	Endpoint *RemoteEndpoint
+	// TargetVMID defaults to the source vmid
+	TargetVMID int
+	// TargetBridge and TargetStorage map everything to one id, BridgeMap and
+	// StorageMap map single source ids
+	TargetBridge  string
+	BridgeMap     map[string]string
+	TargetStorage string
+	StorageMap    map[string]string
+	Online        bool
+	// Delete removes the source guest after a successful migration
+	Delete  bool
+	BWLimit int // KiB/s
+
+	// containers only
+	Restart bool
+	Timeout int
+}
+
+func (o *RemoteMigrateOptions) params() (map[string]interface{}, error) {
+	if nil == o || nil == o.Endpoint || "" == o.Endpoint.Host || "" == o.Endpoint.APIToken {
+		return nil, fmt.Errorf("remote migration needs an endpoint with host and api token")
+	}
+
+	bridges := idMapping(o.BridgeMap, o.TargetBridge)
+	storages := idMapping(o.StorageMap, o.TargetStorage)
+	if "" == bridges || "" == storages {
+		return nil, fmt.Errorf("remote migration needs target bridge and storage mappings")
+	}
+
+	data := map[string]interface{}{
+		"target-endpoint": o.Endpoint.String(),
+		"target-bridge":   bridges,
+		"target-storage":  storages,
+	}
+	if o.TargetVMID > 0 {
+		data["target-vmid"] = o.TargetVMID
+	}
+	if o.Online {
+		data["online"] = 1
+	}
+	if o.Delete {
+		data["delete"] = 1
+	}
+	if o.BWLimit > 0 {
+		data["bwlimit"] = o.BWLimit
+	}
+	if o.Restart {
+		data["restart"] = 1
+	}
+	if o.Timeout > 0 {
+		data["timeout"] = o.Timeout
+	}
+	return data, nil
+}
+
+func (v *VirtualMachine) RemoteMigrate(opts *RemoteMigrateOptions) (task *Task, err error) {
+	data, err := opts.params()
+	if nil != err {
+		return
+	}
+
+	var upid string
+	if err = v.client.Post(fmt.Sprintf("/nodes/%s/qemu/%d/remote_migrate", v.Node, v.VMID), data, &upid); err != nil {
+		return nil, err
+	}
+
+	return NewTask(upid, v.client), nil
+}
+
+func (c *LxcContainer) RemoteMigrate(opts *RemoteMigrateOptions) (task *Task, err error) {
+	data, err := opts.params()
+	if nil != err {
+		return
+	}
+
+	var upid string
+	if err = c.client.Post(fmt.Sprintf("/nodes/%s/lxc/%d/remote_migrate", c.Node, c.VMID), data, &upid); err != nil {
+		return nil, err
+	}
+
+	return NewTask(upid, c.client), nil
+}
+
+// idMapping builds the "source:target,...,fallback" lists pve uses to map
+// storages and bridges.
+func idMapping(mapping map[string]string, all string) string {
+	var items []string
+	for source, target := range mapping {
+		items = append(items, fmt.Sprintf("%s:%s", source, target))
+	}
+	sort.Strings(items)
+	if "" != all {
+		items = append(items, all)
+	}
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,158 @@
+package pve
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RRDTimeframeHour  = "hour"
+	RRDTimeframeDay   = "day"
+	RRDTimeframeWeek  = "week"
+	RRDTimeframeMonth = "month"
+	RRDTimeframeYear  = "year"
+
+	RRDConsolidationAverage = "AVERAGE"
+	RRDConsolidationMax     = "MAX"
+)
+
+// RRDSample is one point of a rrddata series. The common guest values have
+// fields, Values holds every value pve returned including the node and
+// storage specific ones. Values without data in the interval are missing.
+type RRDSample struct {
+	Time      time.Time
+	CPU       float64
+	MaxCPU    float64
+	Mem       float64
+	MaxMem    float64
+	Disk      float64
+	MaxDisk   float64
+	DiskRead  float64
+	DiskWrite float64
+	NetIn     float64
+	NetOut    float64
+	Values    map[string]float64
+}
+
+func (s *RRDSample) UnmarshalJSON(b []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); nil != err {
+		return err
+	}
+
+	*s = RRDSample{Values: map[string]float64{}}
+	for key, value := range raw {
+		f, err := strconv.ParseFloat(configValueString(value), 64)
+		if nil != err {
+			continue
+		}
+		if "time" == key {
+			s.Time = time.Unix(int64(f), 0)
+			continue
+		}
+		s.Values[key] = f
+	}
+
+	for key, field := range map[string]*float64{
+		"cpu": &s.CPU, "maxcpu": &s.MaxCPU, "mem": &s.Mem, "maxmem": &s.MaxMem,
+		"disk": &s.Disk, "maxdisk": &s.MaxDisk, "diskread": &s.DiskRead, "diskwrite": &s.DiskWrite,
+		"netin": &s.NetIn, "netout": &s.NetOut,
+	} {
+		*field = s.Values[key]
+	}
+	return nil
+}
+
+// Get returns the value of name and whether the sample has data for it.
+func (s *RRDSample) Get(name string) (value float64, ok bool) {
+	value, ok = s.Values[name]
+	return
+}
+
+type RRDSamples []*RRDSample
+
+// Series returns the points of name that have data.
+func (ss RRDSamples) Series(name string) (times []time.Time, values []float64) {
+	for _, s := range ss {
+		if value, ok := s.Get(name); ok {
+			times = append(times, s.Time)
+			values = append(values, value)
+		}
+	}
+	return
+}
+
+func rrdQuery(timeframe string, cf []string, ds []string) string {
+	query := url.Values{}
+	if "" == timeframe {
+		timeframe = RRDTimeframeHour
+	}
+	query.Set("timeframe", timeframe)
+	if len(cf) > 0 && "" != cf[0] {
+		query.Set("cf", cf[0])
+	}
+	if len(ds) > 0 {
+		query.Set("ds", strings.Join(ds, ","))
+	}
+	return query.Encode()
+}
+
+func rrdData(c *Client, path, timeframe string, cf []string) (samples RRDSamples, err error) {
+	if err = c.Get(fmt.Sprintf("%s/rrddata?%s", path, rrdQuery(timeframe, cf, nil)), &samples); nil != err {
+		return
+	}
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Time.Before(samples[j].Time)
+	})
+	return
+}
+
+// rrdPNG streams the graph of the data sources ds, the png format lives next
+// to the json api under /api2/png.
+func rrdPNG(c *Client, path string, w io.Writer, ds []string, timeframe string, cf []string) (int64, error) {
+	if len(ds) == 0 {
+		return 0, fmt.Errorf("no data sources given")
+	}
+	base := strings.Replace(c.baseURL, "/api2/json", "/api2/png", 1)
+	return c.Download(fmt.Sprintf("%s%s/rrd?%s", base, path, rrdQuery(timeframe, cf, ds)), w)
+}
+
+// RRDData returns the metrics of timeframe, cf is AVERAGE by default.
+func (v *VirtualMachine) RRDData(timeframe string, cf ...string) (RRDSamples, error) {
+	return rrdData(v.client, fmt.Sprintf("/nodes/%s/qemu/%d", v.Node, v.VMID), timeframe, cf)
+}
+
+// RRDPNG writes the graph of the data sources ds like cpu or netin,netout to w.
+func (v *VirtualMachine) RRDPNG(w io.Writer, ds []string, timeframe string, cf ...string) (int64, error) {
+	return rrdPNG(v.client, fmt.Sprintf("/nodes/%s/qemu/%d", v.Node, v.VMID), w, ds, timeframe, cf)
+}
+
+func (c *LxcContainer) RRDData(timeframe string, cf ...string) (RRDSamples, error) {
+	return rrdData(c.client, fmt.Sprintf("/nodes/%s/lxc/%d", c.Node, c.VMID), timeframe, cf)
+}
+
+func (c *LxcContainer) RRDPNG(w io.Writer, ds []string, timeframe string, cf ...string) (int64, error) {
+	return rrdPNG(c.client, fmt.Sprintf("/nodes/%s/lxc/%d", c.Node, c.VMID), w, ds, timeframe, cf)
+}
+
+func (n *Node) RRDData(timeframe string, cf ...string) (RRDSamples, error) {
+	return rrdData(n.client, fmt.Sprintf("/nodes/%s", n.Name), timeframe, cf)
+}
+
+func (n *Node) RRDPNG(w io.Writer, ds []string, timeframe string, cf ...string) (int64, error) {
+	return rrdPNG(n.client, fmt.Sprintf("/nodes/%s", n.Name), w, ds, timeframe, cf)
+}
+
+func (s *Storage) RRDData(timeframe string, cf ...string) (RRDSamples, error) {
+	return rrdData(s.client, fmt.Sprintf("/nodes/%s/storage/%s", s.Node, s.Name), timeframe, cf)
+}
+
+func (s *Storage) RRDPNG(w io.Writer, ds []string, timeframe string, cf ...string) (int64, error) {
+	return rrdPNG(s.client, fmt.Sprintf("/nodes/%s/storage/%s", s.Node, s.Name), w, ds, timeframe, cf)
+}
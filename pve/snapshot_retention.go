@@ -0,0 +1,282 @@
+package pve
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var DefaultSnapshotLockTimeout = 10 * time.Minute
+
+// Snapshotter is implemented by VirtualMachine and LxcContainer.
+type Snapshotter interface {
+	Snapshots() (Snapshots, error)
+	NewSnapshot(name string, opts ...*SnapshotOptions) (*Task, error)
+	SnapshotDelete(name string) (*Task, error)
+}
+
+// snapshotLocker is implemented by the guests of this package, the retention
+// waits for their lock before each snapshot task
+type snapshotLocker interface {
+	snapshotLock() (string, error)
+}
+
+// pve leaves lock out of the status of an unlocked guest, Ping decodes into
+// the existing struct so a previous lock has to be cleared first
+func (v *VirtualMachine) snapshotLock() (string, error) {
+	v.Lock = ""
+	if err := v.Ping(); nil != err {
+		return "", err
+	}
+	return v.Lock, nil
+}
+
+func (c *LxcContainer) snapshotLock() (string, error) {
+	c.Lock = ""
+	if err := c.Ping(); nil != err {
+		return "", err
+	}
+	return c.Lock, nil
+}
+
+// SnapshotRetentionPolicy selects which snapshots to keep, the rules work like
+// the prune options of vzdump: KeepLast keeps the newest snapshots, the other
+// rules keep the newest snapshot of each hour, day, week or month. Only
+// snapshots named with Prefix are managed, all others are left alone, so
+// Prefix must not be empty. Without any keep rule every snapshot is kept.
+type SnapshotRetentionPolicy struct {
+	Prefix      string
+	KeepLast    int
+	KeepHourly  int
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+	KeepYearly  int
+	// VMState includes the ram in created snapshots of running vms
+	VMState bool
+	// Location is used for the hour, day, week and month boundaries, defaults to local time
+	Location *time.Location
+}
+
+type SnapshotRetentionPlan struct {
+	Create  string
+	Keep    Snapshots
+	Delete  Snapshots
+	Reasons map[string][]string
+}
+
+func (p *SnapshotRetentionPlan) String() string {
+	var lines []string
+	if "" != p.Create {
+		lines = append(lines, fmt.Sprintf("create %s", p.Create))
+	}
+	for _, s := range p.Keep {
+		lines = append(lines, fmt.Sprintf("keep   %s (%s)", s.Name, strings.Join(p.Reasons[s.Name], ", ")))
+	}
+	for _, s := range p.Delete {
+		lines = append(lines, fmt.Sprintf("delete %s", s.Name))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Validate rejects an empty Prefix, it would match the manual snapshots too.
+func (p *SnapshotRetentionPolicy) Validate() error {
+	if "" == p.Prefix {
+		return fmt.Errorf("snapshot retention needs a prefix")
+	}
+	return nil
+}
+
+func (p *SnapshotRetentionPolicy) hasRules() bool {
+	return p.KeepLast > 0 || p.KeepHourly > 0 || p.KeepDaily > 0 || p.KeepWeekly > 0 || p.KeepMonthly > 0 || p.KeepYearly > 0
+}
+
+// SnapshotName returns the name a snapshot created at t gets.
+func (p *SnapshotRetentionPolicy) SnapshotName(t time.Time) string {
+	return p.Prefix + t.In(p.location()).Format("20060102T150405")
+}
+
+func (p *SnapshotRetentionPolicy) location() *time.Location {
+	if nil == p.Location {
+		return time.Local
+	}
+	return p.Location
+}
+
+// Plan computes which of snapshots to keep and to delete at now, with create
+// a new snapshot taken at now is accounted for as the newest one.
+func (p *SnapshotRetentionPolicy) Plan(snapshots Snapshots, now time.Time, create bool) *SnapshotRetentionPlan {
+	plan := &SnapshotRetentionPlan{Reasons: map[string][]string{}}
+
+	var managed Snapshots
+	for _, s := range snapshots {
+		if !s.IsCurrent() && strings.HasPrefix(s.Name, p.Prefix) {
+			managed = append(managed, s)
+		}
+	}
+	if create {
+		plan.Create = p.SnapshotName(now)
+		managed = append(managed, &Snapshot{Name: plan.Create, Snaptime: now.Unix()})
+	}
+	sort.SliceStable(managed, func(i, j int) bool {
+		return managed[i].Snaptime > managed[j].Snaptime
+	})
+
+	kept := map[string]bool{}
+	keep := func(s *Snapshot, reason string) {
+		kept[s.Name] = true
+		plan.Reasons[s.Name] = append(plan.Reasons[s.Name], reason)
+	}
+
+	if !p.hasRules() {
+		for _, s := range managed {
+			keep(s, "no keep rules")
+		}
+	}
+	for i, s := range managed {
+		if i < p.KeepLast {
+			keep(s, "last")
+		}
+	}
+
+	loc := p.location()
+	rules := []struct {
+		reason string
+		count  int
+		bucket func(t time.Time) string
+	}{
+		{"hourly", p.KeepHourly, func(t time.Time) string { return t.Format("2006-01-02 15") }},
+		{"daily", p.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{"weekly", p.KeepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%02d", year, week)
+		}},
+		{"monthly", p.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+		{"yearly", p.KeepYearly, func(t time.Time) string { return t.Format("2006") }},
+	}
+	for _, rule := range rules {
+		if rule.count <= 0 {
+			continue
+		}
+		// buckets already covered by snapshots kept through earlier rules count as used
+		used := map[string]bool{}
+		for _, s := range managed {
+			if kept[s.Name] {
+				used[rule.bucket(time.Unix(s.Snaptime, 0).In(loc))] = true
+			}
+		}
+		count := 0
+		for _, s := range managed {
+			if count >= rule.count {
+				break
+			}
+			b := rule.bucket(time.Unix(s.Snaptime, 0).In(loc))
+			if kept[s.Name] || used[b] {
+				continue
+			}
+			used[b] = true
+			keep(s, rule.reason)
+			count++
+		}
+	}
+
+	for _, s := range managed {
+		if s.Name == plan.Create {
+			continue
+		}
+		if kept[s.Name] {
+			plan.Keep = append(plan.Keep, s)
+		} else {
+			plan.Delete = append(plan.Delete, s)
+		}
+	}
+	return plan
+}
+
+type SnapshotRetentionOptions struct {
+	// Create takes a new snapshot before pruning
+	Create bool
+	// DryRun only computes the plan
+	DryRun      bool
+	Description string
+	// LockTimeout bounds the wait for a locked guest, DefaultSnapshotLockTimeout if 0
+	LockTimeout time.Duration
+	Now         time.Time
+}
+
+// ApplySnapshotRetention plans and executes policy on target. Snapshots are
+// created and deleted one at a time, each waiting for the guest to be
+// unlocked and for its task to finish.
+func ApplySnapshotRetention(target Snapshotter, policy *SnapshotRetentionPolicy, opts *SnapshotRetentionOptions) (plan *SnapshotRetentionPlan, err error) {
+	if nil == opts {
+		opts = &SnapshotRetentionOptions{}
+	}
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	lockTimeout := opts.LockTimeout
+	if lockTimeout <= 0 {
+		lockTimeout = DefaultSnapshotLockTimeout
+	}
+	if err = policy.Validate(); nil != err {
+		return
+	}
+
+	snapshots, err := target.Snapshots()
+	if nil != err {
+		return
+	}
+	plan = policy.Plan(snapshots, now, opts.Create)
+	if opts.DryRun {
+		return
+	}
+
+	if "" != plan.Create {
+		if err = waitSnapshotUnlocked(target, lockTimeout); nil != err {
+			return
+		}
+		err = WaitTaskFunc(func() (*Task, error) {
+			return target.NewSnapshot(plan.Create, &SnapshotOptions{VMState: policy.VMState, Description: opts.Description})
+		}, 0, 2)()
+		if nil != err {
+			return plan, fmt.Errorf("create snapshot %s: %w", plan.Create, err)
+		}
+	}
+
+	for _, s := range plan.Delete {
+		if err = waitSnapshotUnlocked(target, lockTimeout); nil != err {
+			return
+		}
+		err = WaitTaskFunc(func() (*Task, error) {
+			return target.SnapshotDelete(s.Name)
+		}, 0, 2)()
+		if nil != err {
+			return plan, fmt.Errorf("delete snapshot %s: %w", s.Name, err)
+		}
+	}
+
+	return
+}
+
+func waitSnapshotUnlocked(target Snapshotter, timeout time.Duration) error {
+	locker, ok := target.(snapshotLocker)
+	if !ok {
+		return nil
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		lock, err := locker.snapshotLock()
+		if nil != err {
+			return err
+		}
+		if "" == lock {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("guest still locked (%s) after %s", lock, timeout)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
@@ -0,0 +1,159 @@
+package pve
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRetentionPlan(t *testing.T) {
+	at := func(value string) int64 {
+		ts, err := time.Parse(time.RFC3339, value)
+		if nil != err {
+			t.Fatal(err)
+		}
+		return ts.Unix()
+	}
+	plus2 := time.FixedZone("UTC+2", 2*60*60)
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		policy    SnapshotRetentionPolicy
+		snapshots Snapshots
+		create    bool
+		keep      []string
+		delete    []string
+	}{
+		{
+			name:   "keep last",
+			policy: SnapshotRetentionPolicy{Prefix: "auto-", KeepLast: 2},
+			snapshots: Snapshots{
+				{Name: "auto-1", Snaptime: at("2024-01-01T10:00:00Z")},
+				{Name: "auto-2", Snaptime: at("2024-01-02T10:00:00Z")},
+				{Name: "auto-3", Snaptime: at("2024-01-03T10:00:00Z")},
+				{Name: "auto-4", Snaptime: at("2024-01-04T10:00:00Z")},
+			},
+			keep:   []string{"auto-4", "auto-3"},
+			delete: []string{"auto-2", "auto-1"},
+		},
+		{
+			name:   "hour boundary",
+			policy: SnapshotRetentionPolicy{Prefix: "auto-", KeepHourly: 2, Location: time.UTC},
+			snapshots: Snapshots{
+				{Name: "auto-1059", Snaptime: at("2024-01-01T10:59:59Z")},
+				{Name: "auto-1100", Snaptime: at("2024-01-01T11:00:00Z")},
+				{Name: "auto-1130", Snaptime: at("2024-01-01T11:30:00Z")},
+			},
+			keep:   []string{"auto-1130", "auto-1059"},
+			delete: []string{"auto-1100"},
+		},
+		{
+			name:   "day boundary in utc",
+			policy: SnapshotRetentionPolicy{Prefix: "auto-", KeepDaily: 2, Location: time.UTC},
+			snapshots: Snapshots{
+				{Name: "auto-a", Snaptime: at("2024-01-01T21:30:00Z")},
+				{Name: "auto-b", Snaptime: at("2024-01-01T22:30:00Z")},
+				{Name: "auto-c", Snaptime: at("2024-01-01T23:30:00Z")},
+			},
+			keep:   []string{"auto-c"},
+			delete: []string{"auto-b", "auto-a"},
+		},
+		{
+			name:   "day boundary in location",
+			policy: SnapshotRetentionPolicy{Prefix: "auto-", KeepDaily: 2, Location: plus2},
+			snapshots: Snapshots{
+				{Name: "auto-a", Snaptime: at("2024-01-01T21:30:00Z")},
+				{Name: "auto-b", Snaptime: at("2024-01-01T22:30:00Z")},
+				{Name: "auto-c", Snaptime: at("2024-01-01T23:30:00Z")},
+			},
+			keep:   []string{"auto-c", "auto-a"},
+			delete: []string{"auto-b"},
+		},
+		{
+			name:   "iso week boundary",
+			policy: SnapshotRetentionPolicy{Prefix: "auto-", KeepWeekly: 2, Location: time.UTC},
+			snapshots: Snapshots{
+				{Name: "auto-sun", Snaptime: at("2024-01-07T10:00:00Z")},
+				{Name: "auto-mon1", Snaptime: at("2024-01-08T09:00:00Z")},
+				{Name: "auto-mon2", Snaptime: at("2024-01-08T10:00:00Z")},
+			},
+			keep:   []string{"auto-mon2", "auto-sun"},
+			delete: []string{"auto-mon1"},
+		},
+		{
+			name:   "last covers the daily bucket",
+			policy: SnapshotRetentionPolicy{Prefix: "auto-", KeepLast: 1, KeepDaily: 1, Location: time.UTC},
+			snapshots: Snapshots{
+				{Name: "auto-d1", Snaptime: at("2024-01-01T10:00:00Z")},
+				{Name: "auto-d2a", Snaptime: at("2024-01-02T09:00:00Z")},
+				{Name: "auto-d2b", Snaptime: at("2024-01-02T10:00:00Z")},
+			},
+			keep:   []string{"auto-d2b", "auto-d1"},
+			delete: []string{"auto-d2a"},
+		},
+		{
+			name:   "other snapshots are left alone",
+			policy: SnapshotRetentionPolicy{Prefix: "auto-", KeepLast: 1},
+			snapshots: Snapshots{
+				{Name: "before-upgrade", Snaptime: at("2024-01-01T10:00:00Z")},
+				{Name: "auto-1", Snaptime: at("2024-01-02T10:00:00Z")},
+				{Name: "auto-2", Snaptime: at("2024-01-03T10:00:00Z")},
+				{Name: SnapshotCurrent},
+			},
+			keep:   []string{"auto-2"},
+			delete: []string{"auto-1"},
+		},
+		{
+			name:   "created snapshot counts as newest",
+			policy: SnapshotRetentionPolicy{Prefix: "auto-", KeepLast: 1, Location: time.UTC},
+			snapshots: Snapshots{
+				{Name: "auto-1", Snaptime: at("2024-01-09T10:00:00Z")},
+			},
+			create: true,
+			delete: []string{"auto-1"},
+		},
+		{
+			name:   "no rules",
+			policy: SnapshotRetentionPolicy{Prefix: "auto-"},
+			snapshots: Snapshots{
+				{Name: "auto-1", Snaptime: at("2024-01-01T10:00:00Z")},
+				{Name: "auto-2", Snaptime: at("2024-01-02T10:00:00Z")},
+			},
+			keep: []string{"auto-2", "auto-1"},
+		},
+	}
+
+	names := func(ss Snapshots) (names []string) {
+		for _, s := range ss {
+			names = append(names, s.Name)
+		}
+		return
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := tt.policy.Plan(tt.snapshots, now, tt.create)
+			if got := names(plan.Keep); !reflect.DeepEqual(got, tt.keep) {
+				t.Errorf("keep %v, want %v", got, tt.keep)
+			}
+			if got := names(plan.Delete); !reflect.DeepEqual(got, tt.delete) {
+				t.Errorf("delete %v, want %v", got, tt.delete)
+			}
+		})
+	}
+}
+
+func TestSnapshotRetentionName(t *testing.T) {
+	policy := SnapshotRetentionPolicy{Prefix: "auto-", Location: time.FixedZone("UTC+2", 2*60*60)}
+	plan := policy.Plan(nil, time.Date(2024, 1, 1, 23, 30, 0, 0, time.UTC), true)
+	if want := "auto-20240102T013000"; want != plan.Create {
+		t.Errorf("created %s, want %s", plan.Create, want)
+	}
+}
+
+func TestSnapshotRetentionEmptyPrefix(t *testing.T) {
+	_, err := ApplySnapshotRetention(&VirtualMachine{}, &SnapshotRetentionPolicy{KeepLast: 1}, nil)
+	if nil == err {
+		t.Error("empty prefix accepted")
+	}
+}
@@ -40,6 +40,8 @@ type Content struct {
 	Used    StringOrUint64 `json:",omitempty"`
 	Path    string         `json:",omitempty"`
 	Notes   string         `json:",omitempty"`
+	Subtype string         `json:",omitempty"` // qemu or lxc for backups
+	VMID    StringOrUint64 `json:",omitempty"`
 }
 
 type VzTmpls []*VzTmpl
@@ -138,6 +140,19 @@ func (s *Storage) VzTmpl(name string) (vztmpl *VzTmpl, err error) {
 	return
 }
 
+func (s *Storage) Backups() (backups Backups, err error) {
+	if err = s.client.Get(fmt.Sprintf("/nodes/%s/storage/%s/content?content=backup", s.Node, s.Name), &backups); nil != err {
+		return
+	}
+
+	for _, b := range backups {
+		b.client = s.client
+		b.Node = s.Node
+		b.Storage = s.Name
+	}
+	return
+}
+
 func (s *Storage) Backup(name string) (backup *Backup, err error) {
 	err = s.client.Get(fmt.Sprintf("/nodes/%s/storage/%s/content/%s:%s/%s", s.Node, s.Name, s.Name, "backup", name), &backup)
 	if err != nil {
@@ -147,6 +162,9 @@ func (s *Storage) Backup(name string) (backup *Backup, err error) {
 	backup.client = s.client
 	backup.Node = s.Node
 	backup.Storage = s.Name
+	if backup.VolID == "" {
+		backup.VolID = fmt.Sprintf("%s:backup/%s", backup.Storage, name)
+	}
 	return
 }
 
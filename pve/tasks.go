@@ -12,7 +12,7 @@ const (
 	TaskRunning = "running"
 )
 
-type Tasks []*Tasks
+type Tasks []*Task
 type Task struct {
 	client       *Client
 	UPID         string
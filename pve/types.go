@@ -1,6 +1,8 @@
 package pve
 
 import (
+	"bytes"
+	"encoding/json"
 	"strconv"
 	"strings"
 )
@@ -17,6 +19,69 @@ func (d *StringOrUint64) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// StringOrNumber holds values the api returns either as json strings or as
+// bare numbers, depending on the endpoint and pve version.
+type StringOrNumber string
+
+func (s *StringOrNumber) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if bytes.Equal(b, []byte("null")) {
+		*s = ""
+		return nil
+	}
+	if len(b) > 0 && '"' == b[0] {
+		var str string
+		if err := json.Unmarshal(b, &str); err != nil {
+			return err
+		}
+		*s = StringOrNumber(str)
+		return nil
+	}
+	*s = StringOrNumber(b)
+	return nil
+}
+
+func (s StringOrNumber) String() string {
+	return string(s)
+}
+
+func (s StringOrNumber) Int() (int, error) {
+	return strconv.Atoi(string(s))
+}
+
+func (s StringOrNumber) Float() (float64, error) {
+	return strconv.ParseFloat(string(s), 64)
+}
+
+// IntOrBool holds pve booleans, which come as 0/1 numbers, strings or json
+// booleans depending on the endpoint.
+type IntOrBool bool
+
+func (ib *IntOrBool) UnmarshalJSON(b []byte) error {
+	switch strings.Trim(strings.TrimSpace(string(b)), "\"") {
+	case "1", "true", "on", "yes":
+		*ib = true
+	default:
+		*ib = false
+	}
+	return nil
+}
+
+// NewIntOrBool returns a pointer to value, for the optional flags of option
+// structs.
+func NewIntOrBool(value bool) *IntOrBool {
+	ib := IntOrBool(value)
+	return &ib
+}
+
+// MarshalJSON writes the 0/1 form every pve endpoint accepts.
+func (ib IntOrBool) MarshalJSON() ([]byte, error) {
+	if ib {
+		return []byte("1"), nil
+	}
+	return []byte("0"), nil
+}
+
 type VNC struct {
 	Cert     string
 	Port     StringOrUint64
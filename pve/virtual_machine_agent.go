@@ -1,9 +1,11 @@
 package pve
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"github.com/hilaoyu/go-utils/utils"
-	"math"
+	"net/url"
+	"strings"
 	"time"
 )
 
@@ -34,6 +36,7 @@ type AgentOsInfo struct {
 type AgentFileReadResult struct {
 	Content   string         `json:"content,omitempty"`
 	BytesRead StringOrUint64 `json:"bytes-read,omitempty"`
+	Truncated IntOrBool      `json:"truncated,omitempty"`
 }
 
 type AgentExecCommand struct {
@@ -44,10 +47,13 @@ type AgentExecResult struct {
 	Pid int64 `json:"pid,omitempty"`
 }
 type AgentExecStatusResult struct {
-	Exited   int    `json:"exited,omitempty"`
-	OutData  string `json:"out-data,omitempty"`
-	ErrData  string `json:"err-data,omitempty"`
-	Exitcode int    `json:"exitcode,omitempty"`
+	Exited       IntOrBool `json:"exited,omitempty"`
+	OutData      string    `json:"out-data,omitempty"`
+	ErrData      string    `json:"err-data,omitempty"`
+	Exitcode     int       `json:"exitcode,omitempty"`
+	Signal       int       `json:"signal,omitempty"`
+	OutTruncated IntOrBool `json:"out-truncated,omitempty"`
+	ErrTruncated IntOrBool `json:"err-truncated,omitempty"`
 }
 
 func (v *VirtualMachine) AgentGetNetworkIFaces() (iFaces []*AgentNetworkIface, err error) {
@@ -110,7 +116,7 @@ func (v *VirtualMachine) AgentFileRead(file string) (content string, err error)
 	}
 
 	result := &AgentFileReadResult{}
-	err = v.client.Get(fmt.Sprintf("/nodes/%s/qemu/%d/agent/file-read?file=%s", node.Name, v.VMID, file), &result)
+	err = v.client.Get(fmt.Sprintf("/nodes/%s/qemu/%d/agent/file-read?file=%s", node.Name, v.VMID, url.QueryEscape(file)), &result)
 
 	if nil != err {
 		return
@@ -121,14 +127,17 @@ func (v *VirtualMachine) AgentFileRead(file string) (content string, err error)
 	return
 
 }
-func (v *VirtualMachine) AgentFileWrite(file string, content string) (err error) {
+
+// AgentFileWrite writes content to file in the guest, pve base64 encodes the
+// content unless encode is false, then content has to be base64 already.
+func (v *VirtualMachine) AgentFileWrite(file string, content string, encode ...bool) (err error) {
 	node, err := v.client.Node(v.Node)
 	if err != nil {
 		return
 	}
 
-	//content = base64.StdEncoding.EncodeToString([]byte(content))
-	err = v.client.Post(fmt.Sprintf("/nodes/%s/qemu/%d/agent/file-write", node.Name, v.VMID), map[string]interface{}{"file": file, "content": content, "encode": true}, nil)
+	enc := len(encode) == 0 || encode[0]
+	err = v.client.Post(fmt.Sprintf("/nodes/%s/qemu/%d/agent/file-write", node.Name, v.VMID), map[string]interface{}{"file": file, "content": content, "encode": boolToInt(enc)}, nil)
 
 	return
 
@@ -167,47 +176,35 @@ func (v *VirtualMachine) AgentExecStatus(pid int64) (result *AgentExecStatusResu
 
 }
 
-func (v *VirtualMachine) AgentExecSync(command *AgentExecCommand, timeoutSeconds int) (output string, err error) {
-	pid, err := v.AgentExec(command)
-	if nil != err {
-		return
-	}
+// DefaultAgentExecSyncTimeout applies to AgentExecSync calls without a timeout.
+var DefaultAgentExecSyncTimeout = 30 * time.Second
 
-	step := 5
-	times := 6
-	if timeoutSeconds <= 0 {
-		times = timeoutSeconds
-	} else {
-		if timeoutSeconds < step {
-			step = timeoutSeconds
-		}
-		times = int(math.Ceil(float64(timeoutSeconds/step))) + 1
-	}
-
-	result := &AgentExecStatusResult{}
-	utils.ReTry(func() bool {
-		result, _ = v.AgentExecStatus(pid)
-		if 1 == result.Exited {
-			output = result.OutData
-			if "" != result.ErrData {
-				if "" != output {
-					output += " ;; "
-				}
-				output += result.ErrData
-			}
-			if 0 != result.Exitcode {
-				err = fmt.Errorf("执行状态有错误,code: %d", result.Exitcode)
-			}
-			return true
+// AgentExecSync runs command and returns stdout and stderr joined by " ;; ",
+// use AgentCommand for separate streams and the exit code.
+func (v *VirtualMachine) AgentExecSync(command *AgentExecCommand, timeoutSeconds int) (output string, err error) {
+	timeout := time.Duration(timeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = DefaultAgentExecSyncTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stdout, stderr strings.Builder
+	cmd := v.AgentCommandContext(ctx, command.Command, command.Args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+
+	output = stdout.String()
+	if "" != stderr.String() {
+		if "" != output {
+			output += " ;; "
 		}
-
-		return false
-	}, times, time.Duration(step)*time.Second)
-
-	if 1 != result.Exited {
-		err = fmt.Errorf("执行超过时设定的时间: %d秒", timeoutSeconds)
+		output += stderr.String()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("guest command did not finish within %s: %w", timeout, err)
 	}
 
 	return
-
 }
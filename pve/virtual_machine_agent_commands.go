@@ -0,0 +1,211 @@
+package pve
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	AgentFsFreezeStatusThawed = "thawed"
+	AgentFsFreezeStatusFrozen = "frozen"
+)
+
+type AgentInfo struct {
+	Version           string                   `json:"version"`
+	SupportedCommands []*AgentSupportedCommand `json:"supported_commands"`
+}
+
+type AgentSupportedCommand struct {
+	Name            string `json:"name"`
+	Enabled         bool   `json:"enabled"`
+	SuccessResponse bool   `json:"success-response"`
+}
+
+// Supports reports whether command is known and enabled in the guest agent.
+func (i *AgentInfo) Supports(command string) bool {
+	for _, c := range i.SupportedCommands {
+		if c.Name == command {
+			return c.Enabled
+		}
+	}
+	return false
+}
+
+type AgentFsInfo struct {
+	Name       string         `json:"name"`
+	Mountpoint string         `json:"mountpoint"`
+	Type       string         `json:"type"`
+	UsedBytes  uint64         `json:"used-bytes,omitempty"`
+	TotalBytes uint64         `json:"total-bytes,omitempty"`
+	Disk       []*AgentFsDisk `json:"disk"`
+}
+
+type AgentFsDisk struct {
+	Serial        string              `json:"serial,omitempty"`
+	BusType       string              `json:"bus-type"`
+	Bus           int                 `json:"bus"`
+	Target        int                 `json:"target"`
+	Unit          int                 `json:"unit"`
+	Dev           string              `json:"dev,omitempty"`
+	PCIController *AgentPCIController `json:"pci-controller,omitempty"`
+}
+
+type AgentPCIController struct {
+	Domain   int `json:"domain"`
+	Bus      int `json:"bus"`
+	Slot     int `json:"slot"`
+	Function int `json:"function"`
+}
+
+type AgentUser struct {
+	User      string  `json:"user"`
+	Domain    string  `json:"domain,omitempty"`
+	LoginTime float64 `json:"login-time"` // seconds since epoch
+}
+
+func (u *AgentUser) LoginAt() time.Time {
+	sec := int64(u.LoginTime)
+	return time.Unix(sec, int64((u.LoginTime-float64(sec))*1e9))
+}
+
+type AgentTimezone struct {
+	Zone   string `json:"zone,omitempty"`
+	Offset int    `json:"offset"` // seconds east of utc
+}
+
+type AgentVCPU struct {
+	LogicalID  int  `json:"logical-id"`
+	Online     bool `json:"online"`
+	CanOffline bool `json:"can-offline,omitempty"`
+}
+
+type AgentMemoryBlock struct {
+	PhysIndex  uint64 `json:"phys-index"`
+	Online     bool   `json:"online"`
+	CanOffline bool   `json:"can-offline,omitempty"`
+}
+
+type AgentFstrimResult struct {
+	Paths []*AgentFstrimPath `json:"paths"`
+}
+
+type AgentFstrimPath struct {
+	Path    string `json:"path"`
+	Trimmed uint64 `json:"trimmed,omitempty"`
+	Minimum uint64 `json:"minimum,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type agentResult struct {
+	Result interface{} `json:"result"`
+}
+
+func (v *VirtualMachine) agentGet(command string, result interface{}) error {
+	return v.client.Get(fmt.Sprintf("/nodes/%s/qemu/%d/agent/%s", v.Node, v.VMID, command), &agentResult{Result: result})
+}
+
+func (v *VirtualMachine) agentPost(command string, result interface{}) error {
+	return v.client.Post(fmt.Sprintf("/nodes/%s/qemu/%d/agent/%s", v.Node, v.VMID, command), nil, &agentResult{Result: result})
+}
+
+// AgentPing fails when the guest agent does not answer.
+func (v *VirtualMachine) AgentPing() error {
+	return v.agentPost("ping", nil)
+}
+
+func (v *VirtualMachine) AgentInfo() (info *AgentInfo, err error) {
+	err = v.agentGet("info", &info)
+	return
+}
+
+func (v *VirtualMachine) AgentFsInfo() (filesystems []*AgentFsInfo, err error) {
+	err = v.agentGet("get-fsinfo", &filesystems)
+	return
+}
+
+func (v *VirtualMachine) AgentHostName() (hostName string, err error) {
+	result := struct {
+		HostName string `json:"host-name"`
+	}{}
+	err = v.agentGet("get-host-name", &result)
+	return result.HostName, err
+}
+
+func (v *VirtualMachine) AgentUsers() (users []*AgentUser, err error) {
+	err = v.agentGet("get-users", &users)
+	return
+}
+
+func (v *VirtualMachine) AgentTime() (t time.Time, err error) {
+	var nsec int64
+	if err = v.agentGet("get-time", &nsec); nil != err {
+		return
+	}
+	return time.Unix(0, nsec), nil
+}
+
+func (v *VirtualMachine) AgentTimezone() (tz *AgentTimezone, err error) {
+	err = v.agentGet("get-timezone", &tz)
+	return
+}
+
+func (v *VirtualMachine) AgentVCPUs() (vcpus []*AgentVCPU, err error) {
+	err = v.agentGet("get-vcpus", &vcpus)
+	return
+}
+
+func (v *VirtualMachine) AgentMemoryBlocks() (blocks []*AgentMemoryBlock, err error) {
+	err = v.agentGet("get-memory-blocks", &blocks)
+	return
+}
+
+// AgentMemoryBlockSize returns the size of one memory block in bytes.
+func (v *VirtualMachine) AgentMemoryBlockSize() (size uint64, err error) {
+	result := struct {
+		Size uint64 `json:"size"`
+	}{}
+	err = v.agentGet("get-memory-block-info", &result)
+	return result.Size, err
+}
+
+// AgentFsFreezeStatus returns AgentFsFreezeStatusThawed or AgentFsFreezeStatusFrozen.
+func (v *VirtualMachine) AgentFsFreezeStatus() (status string, err error) {
+	err = v.agentGet("fsfreeze-status", &status)
+	return
+}
+
+// AgentFsFreeze freezes all guest filesystems and returns how many were frozen.
+// Writes in the guest block until AgentFsThaw.
+func (v *VirtualMachine) AgentFsFreeze() (count int, err error) {
+	err = v.agentPost("fsfreeze-freeze", &count)
+	return
+}
+
+// AgentFsThaw thaws the guest filesystems and returns how many were thawed.
+func (v *VirtualMachine) AgentFsThaw() (count int, err error) {
+	err = v.agentPost("fsfreeze-thaw", &count)
+	return
+}
+
+func (v *VirtualMachine) AgentFstrim() (result *AgentFstrimResult, err error) {
+	err = v.agentPost("fstrim", &result)
+	return
+}
+
+// AgentShutdown powers the guest off from inside, the agent sends no
+// reply so errors caused by the vanishing agent are expected.
+func (v *VirtualMachine) AgentShutdown() error {
+	return v.agentPost("shutdown", nil)
+}
+
+func (v *VirtualMachine) AgentSuspendDisk() error {
+	return v.agentPost("suspend-disk", nil)
+}
+
+func (v *VirtualMachine) AgentSuspendRAM() error {
+	return v.agentPost("suspend-ram", nil)
+}
+
+func (v *VirtualMachine) AgentSuspendHybrid() error {
+	return v.agentPost("suspend-hybrid", nil)
+}
@@ -0,0 +1,218 @@
+package pve
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrAgentCmdStarted    = errors.New("agent command already started")
+	ErrAgentCmdNotStarted = errors.New("agent command not started")
+)
+
+// AgentCmd runs a command in the guest through the qemu guest agent, it is
+// used like os/exec.Cmd. The agent can not kill a started process, when the
+// context ends Wait returns but the process keeps running in the guest.
+type AgentCmd struct {
+	Path string
+	Args []string
+	// Env entries in the form KEY=value, passed through env(1) so the guest
+	// needs a unix userland
+	Env []string
+	// Stdin is read completely and sent as input-data before the start, the
+	// agent only takes text here
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// PollInterval is the longest wait between two exec-status calls
+	PollInterval time.Duration
+
+	// ProcessState is set once Wait returns after the process exited
+	ProcessState *AgentProcessState
+
+	vm  *VirtualMachine
+	ctx context.Context
+	pid int64
+}
+
+type AgentProcessState struct {
+	Pid          int64
+	ExitCode     int
+	Signal       int
+	OutTruncated bool
+	ErrTruncated bool
+}
+
+func (s *AgentProcessState) Success() bool {
+	return 0 == s.ExitCode && 0 == s.Signal
+}
+
+// AgentExitError is returned by Run and Wait for commands that exited non zero
+// or were killed by a signal.
+type AgentExitError struct {
+	*AgentProcessState
+	// Stderr holds the error output when Cmd.Stderr was not set
+	Stderr []byte
+}
+
+func (e *AgentExitError) Error() string {
+	if 0 != e.Signal {
+		return fmt.Sprintf("guest process %d killed by signal %d", e.Pid, e.Signal)
+	}
+	return fmt.Sprintf("guest process %d exited with status %d", e.Pid, e.ExitCode)
+}
+
+func (v *VirtualMachine) AgentCommand(name string, args ...string) *AgentCmd {
+	return v.AgentCommandContext(context.Background(), name, args...)
+}
+
+func (v *VirtualMachine) AgentCommandContext(ctx context.Context, name string, args ...string) *AgentCmd {
+	return &AgentCmd{Path: name, Args: args, vm: v, ctx: ctx}
+}
+
+// AgentShellContext runs script with sh -c, env is exported to the script and
+// args are available as $0, $1 and so on.
+func (v *VirtualMachine) AgentShellContext(ctx context.Context, script string, env map[string]string, args ...string) *AgentCmd {
+	cmd := v.AgentCommandContext(ctx, "sh", append([]string{"-c", script}, args...)...)
+	for key, value := range env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	sort.Strings(cmd.Env)
+	return cmd
+}
+
+func (c *AgentCmd) String() string {
+	return strings.Join(append([]string{c.Path}, c.Args...), " ")
+}
+
+func (c *AgentCmd) Pid() int64 {
+	return c.pid
+}
+
+func (c *AgentCmd) command() []string {
+	var command []string
+	if len(c.Env) > 0 {
+		command = append(append([]string{"env"}, c.Env...), "--")
+	}
+	return append(append(command, c.Path), c.Args...)
+}
+
+func (c *AgentCmd) Start() error {
+	if 0 != c.pid {
+		return ErrAgentCmdStarted
+	}
+	if nil == c.ctx {
+		c.ctx = context.Background()
+	}
+	if err := c.ctx.Err(); nil != err {
+		return err
+	}
+
+	data := map[string]interface{}{"command": c.command()}
+	if nil != c.Stdin {
+		input, err := io.ReadAll(c.Stdin)
+		if nil != err {
+			return fmt.Errorf("read stdin: %w", err)
+		}
+		data["input-data"] = string(input)
+	}
+
+	result := &AgentExecResult{}
+	if err := c.vm.client.Post(fmt.Sprintf("/nodes/%s/qemu/%d/agent/exec", c.vm.Node, c.vm.VMID), data, result); nil != err {
+		return err
+	}
+	c.pid = result.Pid
+	return nil
+}
+
+// Wait polls the agent until the process exited or the context ended, then
+// copies the output to Stdout and Stderr.
+func (c *AgentCmd) Wait() error {
+	if 0 == c.pid {
+		return ErrAgentCmdNotStarted
+	}
+	if nil != c.ProcessState {
+		return fmt.Errorf("agent command pid %d already waited for", c.pid)
+	}
+
+	maxWait := c.PollInterval
+	if maxWait <= 0 {
+		maxWait = time.Second
+	}
+	wait := 50 * time.Millisecond
+
+	for {
+		status, err := c.vm.AgentExecStatus(c.pid)
+		if nil != err {
+			return err
+		}
+		if status.Exited {
+			return c.finish(status)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-c.ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("guest process %d: %w", c.pid, c.ctx.Err())
+		case <-timer.C:
+		}
+		if wait *= 2; wait > maxWait {
+			wait = maxWait
+		}
+	}
+}
+
+func (c *AgentCmd) finish(status *AgentExecStatusResult) error {
+	c.ProcessState = &AgentProcessState{
+		Pid:          c.pid,
+		ExitCode:     status.Exitcode,
+		Signal:       status.Signal,
+		OutTruncated: bool(status.OutTruncated),
+		ErrTruncated: bool(status.ErrTruncated),
+	}
+
+	if nil != c.Stdout {
+		if _, err := io.WriteString(c.Stdout, status.OutData); nil != err {
+			return err
+		}
+	}
+	if nil != c.Stderr {
+		if _, err := io.WriteString(c.Stderr, status.ErrData); nil != err {
+			return err
+		}
+	}
+
+	if !c.ProcessState.Success() {
+		exitErr := &AgentExitError{AgentProcessState: c.ProcessState}
+		if nil == c.Stderr {
+			exitErr.Stderr = []byte(status.ErrData)
+		}
+		return exitErr
+	}
+	return nil
+}
+
+func (c *AgentCmd) Run() error {
+	if err := c.Start(); nil != err {
+		return err
+	}
+	return c.Wait()
+}
+
+// Output runs the command and returns its standard output.
+func (c *AgentCmd) Output() ([]byte, error) {
+	if nil != c.Stdout {
+		return nil, errors.New("agent command Stdout already set")
+	}
+	var stdout bytes.Buffer
+	c.Stdout = &stdout
+	err := c.Run()
+	return stdout.Bytes(), err
+}
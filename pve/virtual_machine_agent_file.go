@@ -0,0 +1,212 @@
+package pve
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// AgentFileWriteChunkSize is the largest raw chunk whose base64 form fits
+	// the 60 KiB content limit of file-write and the input-data of exec.
+	AgentFileWriteChunkSize = 46080
+	AgentFileReadChunkSize  = 1024 * 1024
+)
+
+// DefaultAgentShellTimeout bounds the helper commands run during file copies.
+var DefaultAgentShellTimeout = 5 * time.Minute
+
+// AgentCopyOptions tunes AgentCopyTo and AgentCopyFrom. Copies of more than
+// one chunk and verification run sh, dd, base64, wc and sha256sum in the guest.
+type AgentCopyOptions struct {
+	ChunkSize int
+	// Size of the source for progress reports of AgentCopyTo, 0 when unknown
+	Size int64
+	// Verify compares size and sha256 checksum of both sides after the copy
+	Verify     bool
+	OnProgress func(done, total int64)
+}
+
+func (o *AgentCopyOptions) chunkSize(def, max int) int {
+	if nil == o || o.ChunkSize <= 0 || o.ChunkSize > max {
+		return def
+	}
+	return o.ChunkSize
+}
+
+func (o *AgentCopyOptions) progress(done, total int64) {
+	if nil != o && nil != o.OnProgress {
+		o.OnProgress(done, total)
+	}
+}
+
+// AgentCopyTo copies everything from r to guestPath. Larger sources are
+// appended chunk by chunk to guestPath.tmp, which is renamed when complete.
+func (v *VirtualMachine) AgentCopyTo(r io.Reader, guestPath string, opts ...*AgentCopyOptions) (n int64, err error) {
+	var opt *AgentCopyOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	var total int64
+	if nil != opt {
+		total = opt.Size
+	}
+	chunkSize := opt.chunkSize(AgentFileWriteChunkSize, AgentFileWriteChunkSize)
+
+	hash := sha256.New()
+	buf := make([]byte, chunkSize)
+	var parts int
+	for {
+		read, readErr := io.ReadFull(r, buf)
+		if nil != readErr && io.EOF != readErr && io.ErrUnexpectedEOF != readErr {
+			err = readErr
+			break
+		}
+		last := read < chunkSize
+
+		if 0 == parts && last {
+			// fits one write, no parts needed
+			if err = v.AgentFileWrite(guestPath, base64.StdEncoding.EncodeToString(buf[:read]), false); nil != err {
+				return
+			}
+			hash.Write(buf[:read])
+			n += int64(read)
+			opt.progress(n, total)
+			break
+		}
+
+		if read > 0 {
+			// each chunk is appended to one temporary file, the first truncates
+			// what a failed copy may have left
+			script := `base64 -d >> "$0.tmp"`
+			if 0 == parts {
+				script = `base64 -d > "$0.tmp"`
+			}
+			if _, err = v.agentShellInput(script, strings.NewReader(base64.StdEncoding.EncodeToString(buf[:read])), guestPath); nil != err {
+				break
+			}
+			hash.Write(buf[:read])
+			n += int64(read)
+			parts++
+			opt.progress(n, total)
+		}
+		if last {
+			_, err = v.agentShell(`mv -f "$0.tmp" "$0"`, guestPath)
+			break
+		}
+	}
+	if nil != err {
+		if parts > 0 {
+			_, _ = v.agentShell(`rm -f "$0.tmp"`, guestPath)
+		}
+		return
+	}
+
+	if nil != opt && opt.Verify {
+		err = v.agentVerify(guestPath, n, hex.EncodeToString(hash.Sum(nil)))
+	}
+	return
+}
+
+// AgentCopyFrom copies guestPath to w, the file is read in chunks through dd
+// and base64 so binary content and files beyond the 16 MiB file-read limit
+// work.
+func (v *VirtualMachine) AgentCopyFrom(guestPath string, w io.Writer, opts ...*AgentCopyOptions) (n int64, err error) {
+	var opt *AgentCopyOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	chunkSize := opt.chunkSize(AgentFileReadChunkSize, 8*AgentFileReadChunkSize)
+
+	total, err := v.agentFileSize(guestPath)
+	if nil != err {
+		return
+	}
+
+	hash := sha256.New()
+	out := io.MultiWriter(w, hash)
+	for block := 0; n < total; block++ {
+		encoded, err := v.agentShell(`dd if="$0" bs="$1" skip="$2" count=1 2>/dev/null | base64`,
+			guestPath, strconv.Itoa(chunkSize), strconv.Itoa(block))
+		if nil != err {
+			return n, err
+		}
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+		if nil != err {
+			return n, fmt.Errorf("decode chunk %d of %s: %w", block, guestPath, err)
+		}
+		if len(data) == 0 {
+			return n, fmt.Errorf("%s shrank to %d bytes while copying", guestPath, n)
+		}
+		written, err := out.Write(data)
+		n += int64(written)
+		if nil != err {
+			return n, err
+		}
+		opt.progress(n, total)
+	}
+
+	if nil != opt && opt.Verify {
+		err = v.agentVerify(guestPath, n, hex.EncodeToString(hash.Sum(nil)))
+	}
+	return
+}
+
+func (v *VirtualMachine) agentFileSize(guestPath string) (size int64, err error) {
+	out, err := v.agentShell(`wc -c < "$0"`, guestPath)
+	if nil != err {
+		return
+	}
+	return strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+}
+
+func (v *VirtualMachine) agentVerify(guestPath string, size int64, checksum string) error {
+	guestSize, err := v.agentFileSize(guestPath)
+	if nil != err {
+		return err
+	}
+	if guestSize != size {
+		return fmt.Errorf("size mismatch for %s: guest %d, local %d", guestPath, guestSize, size)
+	}
+
+	out, err := v.agentShell(`sha256sum "$0"`, guestPath)
+	if nil != err {
+		return err
+	}
+	if fields := strings.Fields(out); len(fields) == 0 || fields[0] != checksum {
+		return fmt.Errorf("checksum mismatch for %s: guest %s, local %s", guestPath, strings.TrimSpace(out), checksum)
+	}
+	return nil
+}
+
+// agentShell runs script with sh -c, args are available as $0, $1 and so on.
+func (v *VirtualMachine) agentShell(script string, args ...string) (stdout string, err error) {
+	return v.agentShellInput(script, nil, args...)
+}
+
+func (v *VirtualMachine) agentShellInput(script string, stdin io.Reader, args ...string) (stdout string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultAgentShellTimeout)
+	defer cancel()
+
+	cmd := v.AgentShellContext(ctx, script, nil, args...)
+	cmd.Stdin = stdin
+	out, err := cmd.Output()
+	var exitErr *AgentExitError
+	if errors.As(err, &exitErr) {
+		return "", fmt.Errorf("%s: %w: %s", script, err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	if nil != err {
+		return
+	}
+	if cmd.ProcessState.OutTruncated {
+		return "", errors.New("guest command output truncated")
+	}
+	return string(out), nil
+}
@@ -0,0 +1,171 @@
+package pve
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultAgentWaitInterval is the pause between two polls of WaitForAgent and WaitForIP.
+var DefaultAgentWaitInterval = 2 * time.Second
+
+// interfaces of container runtimes and virtual bridges inside the guest
+var agentIgnoredInterfacePrefixes = []string{"lo", "docker", "br-", "veth", "virbr", "cni", "flannel", "cali", "vxlan", "tun", "tap"}
+
+var regexpAgentNotConfigured = regexp.MustCompile(`(?i)no qemu guest agent configured`)
+
+// AgentIPFilter selects the address WaitForIP returns. Without IPv4 and IPv6
+// both are accepted and IPv4 is preferred.
+type AgentIPFilter struct {
+	IPv4 bool
+	IPv6 bool
+	// MAC prefers the interface with this address, Net takes it from the vm
+	// config like net0
+	MAC string
+	Net string
+	// AllowLinkLocal accepts fe80::/10 and 169.254.0.0/16 addresses
+	AllowLinkLocal bool
+	// IgnoreInterfaces replaces the default list of ignored interface name
+	// prefixes like docker, veth or br-
+	IgnoreInterfaces []string
+	// IgnoreNetworks drops addresses inside these networks, for example the
+	// docker default 172.17.0.0/16
+	IgnoreNetworks []*net.IPNet
+}
+
+func (f *AgentIPFilter) ignoredInterface(name string) bool {
+	prefixes := agentIgnoredInterfacePrefixes
+	if nil != f.IgnoreInterfaces {
+		prefixes = f.IgnoreInterfaces
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *AgentIPFilter) usable(ip net.IP) bool {
+	if nil == ip || ip.IsLoopback() || ip.IsUnspecified() || ip.IsMulticast() {
+		return false
+	}
+	if !f.AllowLinkLocal && (ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast()) {
+		return false
+	}
+	isV4 := nil != ip.To4()
+	if f.IPv4 != f.IPv6 && isV4 != f.IPv4 {
+		return false
+	}
+	for _, network := range f.IgnoreNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Select returns the best address of ifaces, nil if none matches.
+func (f *AgentIPFilter) Select(ifaces []*AgentNetworkIface) net.IP {
+	var preferred, other []net.IP
+	for _, iface := range ifaces {
+		if f.ignoredInterface(iface.Name) {
+			continue
+		}
+		isPreferred := "" != f.MAC && strings.EqualFold(iface.HardwareAddress, f.MAC)
+		for _, addr := range iface.IpAddresses {
+			ip := net.ParseIP(addr.IpAddress)
+			if !f.usable(ip) {
+				continue
+			}
+			if isPreferred {
+				preferred = append(preferred, ip)
+			} else {
+				other = append(other, ip)
+			}
+		}
+	}
+
+	for _, candidates := range [][]net.IP{preferred, other} {
+		for _, ip := range candidates {
+			if nil != ip.To4() {
+				return ip
+			}
+		}
+		if len(candidates) > 0 {
+			return candidates[0]
+		}
+	}
+	return nil
+}
+
+// WaitForAgent polls until the guest agent answers, errors of a not yet
+// running vm or agent are retried until ctx ends.
+func (v *VirtualMachine) WaitForAgent(ctx context.Context) error {
+	for {
+		err := v.AgentPing()
+		if nil == err {
+			return nil
+		}
+		if regexpAgentNotConfigured.MatchString(err.Error()) {
+			return err
+		}
+		v.client.logger.DebugF("waiting for guest agent of vm %d: %s", v.VMID, err)
+
+		if err := agentWaitSleep(ctx); nil != err {
+			return fmt.Errorf("guest agent of vm %d not ready: %w", v.VMID, err)
+		}
+	}
+}
+
+// WaitForIP waits for the agent and then until the guest reports an address
+// accepted by filter.
+func (v *VirtualMachine) WaitForIP(ctx context.Context, filter *AgentIPFilter) (ip net.IP, err error) {
+	f := AgentIPFilter{}
+	if nil != filter {
+		f = *filter
+	}
+	if "" == f.MAC && "" != f.Net {
+		if err = v.ConfigLoad(); nil != err {
+			return
+		}
+		nic := v.VirtualMachineConfig.Net(f.Net)
+		if nil == nic {
+			return nil, fmt.Errorf("vm %d has no network %s", v.VMID, f.Net)
+		}
+		f.MAC = nic.Mac
+	}
+
+	if err = v.WaitForAgent(ctx); nil != err {
+		return
+	}
+
+	for {
+		ifaces, err := v.AgentGetNetworkIFaces()
+		if nil == err {
+			if ip = f.Select(ifaces); nil != ip {
+				return ip, nil
+			}
+		} else if regexpAgentNotConfigured.MatchString(err.Error()) {
+			return nil, err
+		}
+
+		if err := agentWaitSleep(ctx); nil != err {
+			return nil, fmt.Errorf("vm %d reported no usable address: %w", v.VMID, err)
+		}
+	}
+}
+
+func agentWaitSleep(ctx context.Context) error {
+	timer := time.NewTimer(DefaultAgentWaitInterval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,333 @@
+package pve
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	BiosSeaBIOS = "seabios"
+	BiosOVMF    = "ovmf"
+)
+
+var (
+	vmBuilderRegexpName = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?)*$`)
+	vmBuilderRegexpTag  = regexp.MustCompile(`(?i)^[a-z0-9_][a-z0-9_\-+.]*$`)
+)
+
+// VirtualMachineBuilder collects typed settings for a new vm, use
+// Node.NewVirtualMachineBuilder to get one and Create to send it.
+type VirtualMachineBuilder struct {
+	node    *Node
+	vmid    int
+	pool    string
+	start   bool
+	config  *VirtualMachineConfig
+	boot    []string
+	options map[string]interface{}
+	errs    []error
+}
+
+func (n *Node) NewVirtualMachineBuilder() *VirtualMachineBuilder {
+	return &VirtualMachineBuilder{
+		node:    n,
+		config:  &VirtualMachineConfig{},
+		options: map[string]interface{}{},
+	}
+}
+
+// VMID sets the id of the new vm, without it the next free id of the cluster
+// is used.
+func (b *VirtualMachineBuilder) VMID(id int) *VirtualMachineBuilder {
+	b.vmid = id
+	return b
+}
+
+func (b *VirtualMachineBuilder) Name(name string) *VirtualMachineBuilder {
+	b.config.Name = name
+	return b
+}
+
+func (b *VirtualMachineBuilder) Description(description string) *VirtualMachineBuilder {
+	b.config.Description = description
+	return b
+}
+
+func (b *VirtualMachineBuilder) OSType(osType string) *VirtualMachineBuilder {
+	b.config.OSType = osType
+	return b
+}
+
+func (b *VirtualMachineBuilder) CPU(cpuType string) *VirtualMachineBuilder {
+	b.config.CPU = cpuType
+	return b
+}
+
+func (b *VirtualMachineBuilder) Cores(cores int) *VirtualMachineBuilder {
+	b.config.Cores = cores
+	return b
+}
+
+func (b *VirtualMachineBuilder) Sockets(sockets int) *VirtualMachineBuilder {
+	b.config.Sockets = sockets
+	return b
+}
+
+func (b *VirtualMachineBuilder) Numa(enable bool) *VirtualMachineBuilder {
+	b.config.Numa = boolToInt(enable)
+	b.config.config().markKey("numa")
+	return b
+}
+
+// Memory sets the memory in MiB.
+func (b *VirtualMachineBuilder) Memory(mb uint64) *VirtualMachineBuilder {
+	b.config.Memory = StringOrUint64(mb)
+	return b
+}
+
+// Balloon sets the minimum memory in MiB, 0 disables the balloon device.
+func (b *VirtualMachineBuilder) Balloon(mb int) *VirtualMachineBuilder {
+	b.config.Balloon = mb
+	b.config.config().markKey("balloon")
+	return b
+}
+
+func (b *VirtualMachineBuilder) BIOS(bios string) *VirtualMachineBuilder {
+	b.config.BIOS = bios
+	return b
+}
+
+// UEFI switches to ovmf and adds the efi vars disk on storage.
+func (b *VirtualMachineBuilder) UEFI(storage string, preEnrolledKeys bool) *VirtualMachineBuilder {
+	b.config.BIOS = BiosOVMF
+	disk := &VirtualMachineDisk{
+		Storage:         storage,
+		File:            "1",
+		EfiType:         "4m",
+		PreEnrolledKeys: boolToInt(preEnrolledKeys),
+	}
+	disk.markPropertyPresent("pre-enrolled-keys")
+	return b.Disk("efidisk0", disk)
+}
+
+func (b *VirtualMachineBuilder) TPM(storage string) *VirtualMachineBuilder {
+	return b.Disk("tpmstate0", &VirtualMachineDisk{Storage: storage, File: "1", Version: "v2.0"})
+}
+
+func (b *VirtualMachineBuilder) Machine(machine string) *VirtualMachineBuilder {
+	b.config.Machine = machine
+	return b
+}
+
+func (b *VirtualMachineBuilder) SCSIHW(hw string) *VirtualMachineBuilder {
+	b.config.SCSIHW = hw
+	return b
+}
+
+func (b *VirtualMachineBuilder) Agent(enable bool) *VirtualMachineBuilder {
+	b.config.Agent = StringOrNumber(strconv.Itoa(boolToInt(enable)))
+	return b
+}
+
+func (b *VirtualMachineBuilder) OnBoot(enable bool) *VirtualMachineBuilder {
+	b.config.OnBoot = boolToInt(enable)
+	b.config.config().markKey("onboot")
+	return b
+}
+
+// Disk attaches disk as name, for example scsi0 or virtio1.
+func (b *VirtualMachineBuilder) Disk(name string, disk *VirtualMachineDisk) *VirtualMachineBuilder {
+	if nil == disk {
+		b.errs = append(b.errs, fmt.Errorf("disk %s is nil", name))
+		return b
+	}
+	if err := b.config.SetDisk(name, disk); nil != err {
+		b.errs = append(b.errs, err)
+	}
+	return b
+}
+
+// NewDisk allocates a new volume of sizeGb on storage as name.
+func (b *VirtualMachineBuilder) NewDisk(name, storage string, sizeGb int64) *VirtualMachineBuilder {
+	return b.Disk(name, &VirtualMachineDisk{Storage: storage, File: strconv.FormatInt(sizeGb, 10)})
+}
+
+// CDROM attaches an iso volume like local:iso/debian.iso, "none" leaves the drive empty.
+func (b *VirtualMachineBuilder) CDROM(name, volume string) *VirtualMachineBuilder {
+	return b.Disk(name, &VirtualMachineDisk{File: volume, Media: "cdrom"})
+}
+
+// CloudInitDrive adds the cloud-init drive on storage as name, usually ide2 or scsi1.
+func (b *VirtualMachineBuilder) CloudInitDrive(name, storage string) *VirtualMachineBuilder {
+	return b.Disk(name, &VirtualMachineDisk{Storage: storage, File: "cloudinit", Media: "cdrom"})
+}
+
+func (b *VirtualMachineBuilder) Net(name string, net *VirtualMachineNetwork) *VirtualMachineBuilder {
+	if nil == net {
+		b.errs = append(b.errs, fmt.Errorf("network %s is nil", name))
+		return b
+	}
+	if err := b.config.SetNet(name, net); nil != err {
+		b.errs = append(b.errs, err)
+	}
+	return b
+}
+
+func (b *VirtualMachineBuilder) NewNet(name, model, bridge string) *VirtualMachineBuilder {
+	return b.Net(name, &VirtualMachineNetwork{Type: model, Bridge: bridge})
+}
+
+// BootOrder sets the devices to boot from, in order.
+func (b *VirtualMachineBuilder) BootOrder(devices ...string) *VirtualMachineBuilder {
+	b.boot = devices
+	return b
+}
+
+func (b *VirtualMachineBuilder) Tags(tags ...string) *VirtualMachineBuilder {
+	b.config.Tags = strings.Join(tags, ";")
+	return b
+}
+
+func (b *VirtualMachineBuilder) Pool(pool string) *VirtualMachineBuilder {
+	b.pool = pool
+	return b
+}
+
+func (b *VirtualMachineBuilder) StartOnCreate(start bool) *VirtualMachineBuilder {
+	b.start = start
+	return b
+}
+
+// Option sets any other create parameter as is.
+func (b *VirtualMachineBuilder) Option(name string, value interface{}) *VirtualMachineBuilder {
+	b.options[name] = value
+	return b
+}
+
+// Config gives access to the config being built for settings without a
+// builder method.
+func (b *VirtualMachineBuilder) Config() *VirtualMachineConfig {
+	return b.config
+}
+
+// Validate checks the settings locally, before anything is sent to pve.
+func (b *VirtualMachineBuilder) Validate() error {
+	errs := append([]error{}, b.errs...)
+	cfg := b.config
+
+	if 0 != b.vmid && (b.vmid < 100 || b.vmid > 999999999) {
+		errs = append(errs, fmt.Errorf("vmid %d out of range 100-999999999", b.vmid))
+	}
+	if "" != cfg.Name && !vmBuilderRegexpName.MatchString(cfg.Name) {
+		errs = append(errs, fmt.Errorf("name %q is not a valid dns name", cfg.Name))
+	}
+	if cfg.Cores < 0 || cfg.Sockets < 0 {
+		errs = append(errs, fmt.Errorf("cores and sockets must be positive"))
+	}
+	if 0 != cfg.Memory && cfg.Memory < 16 {
+		errs = append(errs, fmt.Errorf("memory %dMiB is below the minimum of 16MiB", cfg.Memory))
+	}
+	if cfg.Balloon > 0 && 0 != cfg.Memory && uint64(cfg.Balloon) > uint64(cfg.Memory) {
+		errs = append(errs, fmt.Errorf("balloon %dMiB exceeds memory %dMiB", cfg.Balloon, cfg.Memory))
+	}
+	switch cfg.BIOS {
+	case "", BiosSeaBIOS:
+		if nil != cfg.EFIDisk0 {
+			errs = append(errs, fmt.Errorf("efidisk0 requires bios %s", BiosOVMF))
+		}
+	case BiosOVMF:
+	default:
+		errs = append(errs, fmt.Errorf("unknown bios %s", cfg.BIOS))
+	}
+	for name, disk := range cfg.Disks() {
+		if "" == disk.File {
+			errs = append(errs, fmt.Errorf("disk %s has no volume", name))
+		}
+	}
+	for name, net := range cfg.Nets {
+		if _, ok := vmNetworkModels[net.Type]; !ok {
+			errs = append(errs, fmt.Errorf("network %s has unknown model %q", name, net.Type))
+		}
+		if "" == net.Bridge {
+			errs = append(errs, fmt.Errorf("network %s has no bridge", name))
+		}
+	}
+	for _, device := range b.boot {
+		if nil == cfg.Disk(device) && nil == cfg.Net(device) {
+			errs = append(errs, fmt.Errorf("boot device %s is not configured", device))
+		}
+	}
+	for _, tag := range strings.Split(cfg.Tags, ";") {
+		if "" != tag && !vmBuilderRegexpTag.MatchString(tag) {
+			errs = append(errs, fmt.Errorf("invalid tag %q", tag))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (b *VirtualMachineBuilder) createOptions(vmid int) map[string]interface{} {
+	data := map[string]interface{}{}
+	for _, option := range b.config.ToOptions() {
+		data[option.Name] = option.Value
+	}
+	if len(b.boot) > 0 {
+		data["boot"] = "order=" + strings.Join(b.boot, ";")
+	}
+	if "" != b.pool {
+		data["pool"] = b.pool
+	}
+	if b.start {
+		data["start"] = 1
+	}
+	for name, value := range b.options {
+		data[name] = value
+	}
+	data["vmid"] = vmid
+	return data
+}
+
+// Create validates the settings, creates the vm, waits for the create task and
+// returns the new vm. Without an explicit vmid the id is allocated race safe.
+func (b *VirtualMachineBuilder) Create() (vm *VirtualMachine, err error) {
+	if err = b.Validate(); nil != err {
+		return
+	}
+
+	create := func(id int) (*Task, error) {
+		var upid string
+		err := b.node.client.Post(fmt.Sprintf("/nodes/%s/qemu", b.node.Name), b.createOptions(id), &upid)
+		return NewTask(upid, b.node.client), err
+	}
+
+	vmid := b.vmid
+	if 0 == vmid {
+		cluster, err := b.node.client.Cluster()
+		if nil != err {
+			return nil, err
+		}
+		if vmid, _, err = cluster.AllocateVMIDTask(create, 60, 5); nil != err {
+			return nil, fmt.Errorf("create vm %d failed: %w", vmid, err)
+		}
+	} else {
+		task, err := create(vmid)
+		if nil == err && nil != task {
+			err = task.WaitForComplete(60, 5)
+		}
+		if nil != err {
+			return nil, fmt.Errorf("create vm %d failed: %w", vmid, err)
+		}
+	}
+
+	return b.node.VirtualMachine(vmid)
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
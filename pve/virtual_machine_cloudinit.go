@@ -0,0 +1,210 @@
+package pve
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	CloudInitDumpUser    = "user"
+	CloudInitDumpNetwork = "network"
+	CloudInitDumpMeta    = "meta"
+)
+
+// CloudInitIPConfig is an ipconfigN option, IP and IP6 take a cidr or dhcp,
+// IP6 also accepts auto.
+type CloudInitIPConfig struct {
+	propertyStringState
+	IP    string            `json:"ip,omitempty" pve:"ip"`
+	GW    string            `json:"gw,omitempty" pve:"gw"`
+	IP6   string            `json:"ip6,omitempty" pve:"ip6"`
+	GW6   string            `json:"gw6,omitempty" pve:"gw6"`
+	Extra map[string]string `json:"extra,omitempty" pve:",extra"`
+}
+
+func (c *CloudInitIPConfig) String() string {
+	str, _ := MarshalPropertyString(c)
+	return str
+}
+
+// CloudInitCustom is the cicustom option, every field takes a snippet volume
+// like local:snippets/user.yaml.
+type CloudInitCustom struct {
+	propertyStringState
+	User    string            `json:"user,omitempty" pve:"user"`
+	Network string            `json:"network,omitempty" pve:"network"`
+	Meta    string            `json:"meta,omitempty" pve:"meta"`
+	Vendor  string            `json:"vendor,omitempty" pve:"vendor"`
+	Extra   map[string]string `json:"extra,omitempty" pve:",extra"`
+}
+
+func (c *CloudInitCustom) String() string {
+	str, _ := MarshalPropertyString(c)
+	return str
+}
+
+type CloudInitConfig struct {
+	Type          string
+	User          string
+	Password      string
+	SSHKeys       []string
+	IPConfigs     map[int]*CloudInitIPConfig
+	Nameservers   []string
+	Searchdomains []string
+	Custom        *CloudInitCustom
+	Upgrade       *bool
+}
+
+// ToOptions returns the vm options for the non empty settings.
+func (c *CloudInitConfig) ToOptions() (options []VirtualMachineOption) {
+	add := func(name string, value interface{}) {
+		options = append(options, VirtualMachineOption{Name: name, Value: value})
+	}
+
+	if "" != c.Type {
+		add("citype", c.Type)
+	}
+	if "" != c.User {
+		add("ciuser", c.User)
+	}
+	if "" != c.Password {
+		add("cipassword", c.Password)
+	}
+	if len(c.SSHKeys) > 0 {
+		add("sshkeys", EncodeSSHKeys(c.SSHKeys))
+	}
+	if len(c.Nameservers) > 0 {
+		add("nameserver", strings.Join(c.Nameservers, " "))
+	}
+	if len(c.Searchdomains) > 0 {
+		add("searchdomain", strings.Join(c.Searchdomains, " "))
+	}
+	if nil != c.Custom {
+		add("cicustom", c.Custom.String())
+	}
+	if nil != c.Upgrade {
+		add("ciupgrade", boolToInt(*c.Upgrade))
+	}
+
+	indexes := make([]int, 0, len(c.IPConfigs))
+	for i := range c.IPConfigs {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	for _, i := range indexes {
+		if nil != c.IPConfigs[i] {
+			add(fmt.Sprintf("ipconfig%d", i), c.IPConfigs[i].String())
+		}
+	}
+
+	return
+}
+
+// CloudInit reads the cloud-init settings out of the config.
+func (vmc *VirtualMachineConfig) CloudInit() (ci *CloudInitConfig, err error) {
+	ci = &CloudInitConfig{
+		Type:          vmc.CIType,
+		User:          vmc.CIUser,
+		Password:      vmc.CIPassword,
+		Nameservers:   strings.Fields(vmc.Nameserver),
+		Searchdomains: strings.Fields(vmc.Searchdomain),
+	}
+
+	if "" != vmc.SSHKeys {
+		if ci.SSHKeys, err = DecodeSSHKeys(vmc.SSHKeys); nil != err {
+			return
+		}
+	}
+	if "" != vmc.CICustom {
+		ci.Custom = &CloudInitCustom{}
+		if err = UnmarshalPropertyString(vmc.CICustom, ci.Custom); nil != err {
+			return
+		}
+	}
+	if _, ok := vmc.keys["ciupgrade"]; ok {
+		upgrade := 1 == vmc.CIUpgrade
+		ci.Upgrade = &upgrade
+	}
+
+	for key, conf := range vmc.IPConfigs {
+		i, err := strconv.Atoi(strings.TrimPrefix(key, "ipconfig"))
+		if nil != err {
+			continue
+		}
+		ipConfig := &CloudInitIPConfig{}
+		if err = UnmarshalPropertyString(conf, ipConfig); nil != err {
+			return nil, err
+		}
+		if nil == ci.IPConfigs {
+			ci.IPConfigs = map[int]*CloudInitIPConfig{}
+		}
+		ci.IPConfigs[i] = ipConfig
+	}
+
+	return
+}
+
+// CloudInitSet writes the cloud-init settings, they are picked up by the drive
+// on the next start or after CloudInitRegenerate.
+func (v *VirtualMachine) CloudInitSet(ci *CloudInitConfig) (*Task, error) {
+	return v.Config(ci.ToOptions()...)
+}
+
+func (v *VirtualMachine) CloudInitGet() (ci *CloudInitConfig, err error) {
+	if err = v.ConfigLoad(true); nil != err {
+		return
+	}
+	return v.VirtualMachineConfig.CloudInit()
+}
+
+// CloudInitRegenerate rebuilds the cloud-init drive from the current config.
+func (v *VirtualMachine) CloudInitRegenerate() (err error) {
+	err = v.client.Put(fmt.Sprintf("/nodes/%s/qemu/%d/cloudinit", v.Node, v.VMID), nil, nil)
+	return
+}
+
+// CloudInitDump returns the rendered user, network or meta data.
+func (v *VirtualMachine) CloudInitDump(dumpType string) (content string, err error) {
+	err = v.client.Get(fmt.Sprintf("/nodes/%s/qemu/%d/cloudinit/dump?type=%s", v.Node, v.VMID, url.QueryEscape(dumpType)), &content)
+	return
+}
+
+func (b *VirtualMachineBuilder) CloudInit(ci *CloudInitConfig) *VirtualMachineBuilder {
+	for _, option := range ci.ToOptions() {
+		if err := b.config.Set(option.Name, fmt.Sprintf("%v", option.Value)); nil != err {
+			b.errs = append(b.errs, err)
+		}
+	}
+	return b
+}
+
+// EncodeSSHKeys joins keys by newline and percent-encodes them the way pve
+// expects for the sshkeys option, spaces become %20 and not +.
+func EncodeSSHKeys(keys []string) string {
+	var sb strings.Builder
+	for _, c := range []byte(strings.Join(keys, "\n")) {
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+			strings.IndexByte("-_.!~*'()", c) >= 0 {
+			sb.WriteByte(c)
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("%%%02X", c))
+	}
+	return sb.String()
+}
+
+func DecodeSSHKeys(encoded string) (keys []string, err error) {
+	decoded, err := url.PathUnescape(encoded)
+	if nil != err {
+		return
+	}
+	for _, key := range strings.Split(decoded, "\n") {
+		if key = strings.TrimSpace(key); "" != key {
+			keys = append(keys, key)
+		}
+	}
+	return
+}
@@ -0,0 +1,517 @@
+package pve
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// indexed config keys and the number of slots pve allows for each of them
+var vmConfigDeviceLimits = map[string]int{
+	"ide":      4,
+	"sata":     6,
+	"scsi":     31,
+	"virtio":   16,
+	"efidisk":  1,
+	"tpmstate": 1,
+	"unused":   256,
+	"net":      32,
+	"hostpci":  16,
+	"usb":      14,
+	"serial":   4,
+	"parallel": 3,
+	"ipconfig": 32,
+	"numa":     8,
+	"virtiofs": 10,
+}
+
+// keys returned by the config endpoint that can not be posted back
+var vmConfigSchema = newGuestConfigSchema(VirtualMachineConfig{}, vmConfigDeviceLimits,
+	"digest", "lock", "parent", "snaptime", "vmstate", "runningmachine", "runningcpu")
+
+type VirtualMachineConfig struct {
+	Name        string         `json:"name,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Tags        string         `json:"tags,omitempty"`
+	OSType      string         `json:"ostype,omitempty"`
+	Machine     string         `json:"machine,omitempty"`
+	BIOS        string         `json:"bios,omitempty"`
+	Arch        string         `json:"arch,omitempty"`
+	CPU         string         `json:"cpu,omitempty"`
+	CPULimit    StringOrNumber `json:"cpulimit,omitempty"`
+	CPUUnits    int            `json:"cpuunits,omitempty"`
+	Affinity    string         `json:"affinity,omitempty"`
+	Cores       int            `json:"cores,omitempty"`
+	Sockets     int            `json:"sockets,omitempty"`
+	VCPUs       int            `json:"vcpus,omitempty"`
+	Numa        int            `json:"numa,omitempty"`
+	Memory      StringOrUint64 `json:"memory,omitempty"`
+	Balloon     int            `json:"balloon,omitempty"`
+	Shares      int            `json:"shares,omitempty"`
+	Hugepages   string         `json:"hugepages,omitempty"`
+	SCSIHW      string         `json:"scsihw,omitempty"`
+	Boot        string         `json:"boot,omitempty"`
+	BootDisk    string         `json:"bootdisk,omitempty"`
+	OnBoot      int            `json:"onboot,omitempty"`
+	Startup     string         `json:"startup,omitempty"`
+	Agent       StringOrNumber `json:"agent,omitempty"`
+	ACPI        int            `json:"acpi,omitempty"`
+	KVM         int            `json:"kvm,omitempty"`
+	Tablet      int            `json:"tablet,omitempty"`
+	Localtime   int            `json:"localtime,omitempty"`
+	Freeze      int            `json:"freeze,omitempty"`
+	Reboot      int            `json:"reboot,omitempty"`
+	Protection  int            `json:"protection,omitempty"`
+	Template    int            `json:"template,omitempty"`
+	Hotplug     StringOrNumber `json:"hotplug,omitempty"`
+	VGA         string         `json:"vga,omitempty"`
+	Keyboard    string         `json:"keyboard,omitempty"`
+	Watchdog    string         `json:"watchdog,omitempty"`
+	Audio0      string         `json:"audio0,omitempty"`
+	Rng0        string         `json:"rng0,omitempty"`
+	SMBios1     string         `json:"smbios1,omitempty"`
+	Args        string         `json:"args,omitempty"`
+	Hookscript  string         `json:"hookscript,omitempty"`
+	StartDate   string         `json:"startdate,omitempty"`
+	VMGenID     string         `json:"vmgenid,omitempty"`
+	VMStateStor string         `json:"vmstatestorage,omitempty"`
+	Meta        string         `json:"meta,omitempty"`
+
+	CIType       string `json:"citype,omitempty"`
+	CIUser       string `json:"ciuser,omitempty"`
+	CIPassword   string `json:"cipassword,omitempty"`
+	CICustom     string `json:"cicustom,omitempty"`
+	CIUpgrade    int    `json:"ciupgrade,omitempty"`
+	SSHKeys      string `json:"sshkeys,omitempty"`
+	Nameserver   string `json:"nameserver,omitempty"`
+	Searchdomain string `json:"searchdomain,omitempty"`
+
+	Digest string `json:"digest,omitempty"`
+	Lock   string `json:"lock,omitempty"`
+	Parent string `json:"parent,omitempty"`
+
+	IDEs      map[string]*VirtualMachineDisk    `json:"-"`
+	SATAs     map[string]*VirtualMachineDisk    `json:"-"`
+	SCSIs     map[string]*VirtualMachineDisk    `json:"-"`
+	VirtIOs   map[string]*VirtualMachineDisk    `json:"-"`
+	Unuseds   map[string]*VirtualMachineDisk    `json:"-"`
+	EFIDisk0  *VirtualMachineDisk               `json:"-"`
+	TPMState0 *VirtualMachineDisk               `json:"-"`
+	Nets      map[string]*VirtualMachineNetwork `json:"-"`
+	HostPCIs  map[string]string                 `json:"-"`
+	USBs      map[string]string                 `json:"-"`
+	Serials   map[string]string                 `json:"-"`
+	Parallels map[string]string                 `json:"-"`
+	IPConfigs map[string]string                 `json:"-"`
+	NUMAs     map[string]string                 `json:"-"`
+	VirtioFSs map[string]string                 `json:"-"`
+
+	// Raw holds every key this model has no field for, verbatim
+	Raw map[string]string `json:"-"`
+
+	// keys present in the loaded config, so zero values survive a round trip
+	keys map[string]struct{}
+}
+
+func (vmc *VirtualMachineConfig) config() *guestConfig {
+	return &guestConfig{
+		schema:  vmConfigSchema,
+		fields:  reflect.ValueOf(vmc).Elem(),
+		raw:     &vmc.Raw,
+		keys:    &vmc.keys,
+		devices: vmc,
+	}
+}
+
+func (vmc *VirtualMachineConfig) UnmarshalJSON(b []byte) error {
+	*vmc = VirtualMachineConfig{}
+	return vmc.config().unmarshalJSON(b)
+}
+
+func (vmc *VirtualMachineConfig) MarshalJSON() ([]byte, error) {
+	return vmc.config().marshalJSON()
+}
+
+// Set parses value into the typed field or device map for key, keys without
+// a typed representation are kept in Raw.
+func (vmc *VirtualMachineConfig) Set(key string, value string) error {
+	return vmc.config().set(key, value)
+}
+
+// Get returns the option string pve expects for key.
+func (vmc *VirtualMachineConfig) Get(key string) (value string, ok bool) {
+	return vmc.config().get(key)
+}
+
+func (vmc *VirtualMachineConfig) Del(key string) {
+	vmc.config().del(key)
+}
+
+// Keys lists every key set in this config, sorted.
+func (vmc *VirtualMachineConfig) Keys() []string {
+	return vmc.config().keyList()
+}
+
+// ToOptions converts the config back into the options accepted by
+// VirtualMachine.Config, leaving out read-only keys like digest or lock.
+func (vmc *VirtualMachineConfig) ToOptions() []VirtualMachineOption {
+	return vmc.config().options()
+}
+
+func (vmc *VirtualMachineConfig) Disk(name string) *VirtualMachineDisk {
+	name = strings.ToLower(name)
+	prefix, ok := vmConfigSchema.devicePrefix(name)
+	if !ok {
+		return nil
+	}
+	switch prefix {
+	case "efidisk":
+		return vmc.EFIDisk0
+	case "tpmstate":
+		return vmc.TPMState0
+	}
+	if disks := vmc.diskMap(prefix); nil != disks {
+		return (*disks)[name]
+	}
+	return nil
+}
+
+// Disks returns all attached disk devices keyed by name, unused volumes are
+// not included.
+func (vmc *VirtualMachineConfig) Disks() map[string]*VirtualMachineDisk {
+	disks := map[string]*VirtualMachineDisk{}
+	for _, m := range []map[string]*VirtualMachineDisk{vmc.IDEs, vmc.SATAs, vmc.SCSIs, vmc.VirtIOs} {
+		for name, disk := range m {
+			disks[name] = disk
+		}
+	}
+	if nil != vmc.EFIDisk0 {
+		disks["efidisk0"] = vmc.EFIDisk0
+	}
+	if nil != vmc.TPMState0 {
+		disks["tpmstate0"] = vmc.TPMState0
+	}
+	return disks
+}
+
+func (vmc *VirtualMachineConfig) Net(name string) *VirtualMachineNetwork {
+	return vmc.Nets[strings.ToLower(name)]
+}
+
+func (vmc *VirtualMachineConfig) SetDisk(name string, disk *VirtualMachineDisk) error {
+	name = strings.ToLower(name)
+	prefix, ok := vmConfigSchema.devicePrefix(name)
+	if !ok {
+		return fmt.Errorf("invalid disk name %s", name)
+	}
+	disk.Name = name
+	switch prefix {
+	case "efidisk":
+		vmc.EFIDisk0 = disk
+	case "tpmstate":
+		vmc.TPMState0 = disk
+	default:
+		disks := vmc.diskMap(prefix)
+		if nil == disks {
+			return fmt.Errorf("invalid disk name %s", name)
+		}
+		if nil == *disks {
+			*disks = map[string]*VirtualMachineDisk{}
+		}
+		(*disks)[name] = disk
+	}
+	vmc.config().markKey(name)
+	return nil
+}
+
+func (vmc *VirtualMachineConfig) SetNet(name string, net *VirtualMachineNetwork) error {
+	name = strings.ToLower(name)
+	if prefix, ok := vmConfigSchema.devicePrefix(name); !ok || "net" != prefix {
+		return fmt.Errorf("invalid network name %s", name)
+	}
+	net.Name = name
+	if nil == vmc.Nets {
+		vmc.Nets = map[string]*VirtualMachineNetwork{}
+	}
+	vmc.Nets[name] = net
+	vmc.config().markKey(name)
+	return nil
+}
+
+func (vmc *VirtualMachineConfig) setDevice(key, value string) (isDevice bool, err error) {
+	prefix, isDevice := vmConfigSchema.devicePrefix(key)
+	if !isDevice {
+		return
+	}
+	return true, vmc.parseDevice(prefix, key, value)
+}
+
+func (vmc *VirtualMachineConfig) deviceValue(key string) (value string, isDevice bool, ok bool) {
+	prefix, isDevice := vmConfigSchema.devicePrefix(key)
+	if !isDevice {
+		return
+	}
+	switch prefix {
+	case "efidisk":
+		if nil != vmc.EFIDisk0 {
+			return vmc.EFIDisk0.String(), true, true
+		}
+	case "tpmstate":
+		if nil != vmc.TPMState0 {
+			return vmc.TPMState0.String(), true, true
+		}
+	case "net":
+		if net, found := vmc.Nets[key]; found && nil != net {
+			return net.String(), true, true
+		}
+	default:
+		if disks := vmc.diskMap(prefix); nil != disks {
+			if disk, found := (*disks)[key]; found && nil != disk {
+				return disk.String(), true, true
+			}
+		} else if strs := vmc.stringMap(prefix); nil != strs {
+			value, ok = (*strs)[key]
+			return value, true, ok
+		}
+	}
+	return "", true, false
+}
+
+func (vmc *VirtualMachineConfig) delDevice(key string) {
+	prefix, ok := vmConfigSchema.devicePrefix(key)
+	if !ok {
+		return
+	}
+	switch prefix {
+	case "efidisk":
+		vmc.EFIDisk0 = nil
+	case "tpmstate":
+		vmc.TPMState0 = nil
+	case "net":
+		delete(vmc.Nets, key)
+	default:
+		if disks := vmc.diskMap(prefix); nil != disks {
+			delete(*disks, key)
+		} else if strs := vmc.stringMap(prefix); nil != strs {
+			delete(*strs, key)
+		}
+	}
+}
+
+func (vmc *VirtualMachineConfig) deviceKeys() (keys []string) {
+	for prefix := range vmConfigDeviceLimits {
+		keys = append(keys, vmc.prefixKeys(prefix)...)
+	}
+	return
+}
+
+func (vmc *VirtualMachineConfig) parseDevice(prefix, key, value string) (err error) {
+	switch prefix {
+	case "efidisk", "tpmstate":
+		disk := &VirtualMachineDisk{}
+		if err = disk.Parse(value); nil != err {
+			return
+		}
+		disk.Name = key
+		if "efidisk" == prefix {
+			vmc.EFIDisk0 = disk
+		} else {
+			vmc.TPMState0 = disk
+		}
+		return
+	case "net":
+		net := &VirtualMachineNetwork{}
+		if err = net.Parse(value); nil != err {
+			return
+		}
+		net.Name = key
+		if nil == vmc.Nets {
+			vmc.Nets = map[string]*VirtualMachineNetwork{}
+		}
+		vmc.Nets[key] = net
+		return
+	}
+
+	if disks := vmc.diskMap(prefix); nil != disks {
+		disk := &VirtualMachineDisk{}
+		if err = disk.Parse(value); nil != err {
+			return
+		}
+		disk.Name = key
+		if nil == *disks {
+			*disks = map[string]*VirtualMachineDisk{}
+		}
+		(*disks)[key] = disk
+		return
+	}
+
+	if strs := vmc.stringMap(prefix); nil != strs {
+		if nil == *strs {
+			*strs = map[string]string{}
+		}
+		(*strs)[key] = value
+	}
+	return
+}
+
+func (vmc *VirtualMachineConfig) prefixKeys(prefix string) (keys []string) {
+	switch prefix {
+	case "efidisk":
+		if nil != vmc.EFIDisk0 {
+			keys = append(keys, "efidisk0")
+		}
+	case "tpmstate":
+		if nil != vmc.TPMState0 {
+			keys = append(keys, "tpmstate0")
+		}
+	case "net":
+		for key, net := range vmc.Nets {
+			if nil != net {
+				keys = append(keys, key)
+			}
+		}
+	default:
+		if disks := vmc.diskMap(prefix); nil != disks {
+			for key, disk := range *disks {
+				if nil != disk {
+					keys = append(keys, key)
+				}
+			}
+		} else if strs := vmc.stringMap(prefix); nil != strs {
+			for key := range *strs {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return
+}
+
+func (vmc *VirtualMachineConfig) diskMap(prefix string) *map[string]*VirtualMachineDisk {
+	switch prefix {
+	case "ide":
+		return &vmc.IDEs
+	case "sata":
+		return &vmc.SATAs
+	case "scsi":
+		return &vmc.SCSIs
+	case "virtio":
+		return &vmc.VirtIOs
+	case "unused":
+		return &vmc.Unuseds
+	}
+	return nil
+}
+
+func (vmc *VirtualMachineConfig) stringMap(prefix string) *map[string]string {
+	switch prefix {
+	case "hostpci":
+		return &vmc.HostPCIs
+	case "usb":
+		return &vmc.USBs
+	case "serial":
+		return &vmc.Serials
+	case "parallel":
+		return &vmc.Parallels
+	case "ipconfig":
+		return &vmc.IPConfigs
+	case "numa":
+		return &vmc.NUMAs
+	case "virtiofs":
+		return &vmc.VirtioFSs
+	}
+	return nil
+}
+
+type VirtualMachineAgent struct {
+	propertyStringState
+	Enabled           int               `json:"enabled,omitempty" pve:"enabled,default"`
+	FstrimClonedDisks int               `json:"fstrim_cloned_disks,omitempty" pve:"fstrim_cloned_disks"`
+	FreezeFsOnBackup  int               `json:"freeze-fs-on-backup,omitempty" pve:"freeze-fs-on-backup"`
+	Type              string            `json:"type,omitempty" pve:"type"`
+	Extra             map[string]string `json:"extra,omitempty" pve:",extra"`
+}
+
+func (a *VirtualMachineAgent) String() string {
+	str, _ := MarshalPropertyString(a)
+	return str
+}
+
+type VirtualMachineStartup struct {
+	propertyStringState
+	Order int               `json:"order,omitempty" pve:"order"`
+	Up    int               `json:"up,omitempty" pve:"up"`
+	Down  int               `json:"down,omitempty" pve:"down"`
+	Extra map[string]string `json:"extra,omitempty" pve:",extra"`
+}
+
+func (s *VirtualMachineStartup) String() string {
+	str, _ := MarshalPropertyString(s)
+	return str
+}
+
+type VirtualMachineHostPCI struct {
+	propertyStringState
+	Host        string            `json:"host,omitempty" pve:"host,default"`
+	Mapping     string            `json:"mapping,omitempty" pve:"mapping"`
+	PCIe        int               `json:"pcie,omitempty" pve:"pcie"`
+	Rombar      int               `json:"rombar,omitempty" pve:"rombar"`
+	Romfile     string            `json:"romfile,omitempty" pve:"romfile"`
+	XVga        int               `json:"x-vga,omitempty" pve:"x-vga"`
+	Mdev        string            `json:"mdev,omitempty" pve:"mdev"`
+	LegacyIGD   int               `json:"legacy-igd,omitempty" pve:"legacy-igd"`
+	DeviceID    string            `json:"device-id,omitempty" pve:"device-id"`
+	VendorID    string            `json:"vendor-id,omitempty" pve:"vendor-id"`
+	SubDeviceID string            `json:"sub-device-id,omitempty" pve:"sub-device-id"`
+	SubVendorID string            `json:"sub-vendor-id,omitempty" pve:"sub-vendor-id"`
+	Extra       map[string]string `json:"extra,omitempty" pve:",extra"`
+}
+
+func (h *VirtualMachineHostPCI) String() string {
+	str, _ := MarshalPropertyString(h)
+	return str
+}
+
+type VirtualMachineUSB struct {
+	propertyStringState
+	Host    string            `json:"host,omitempty" pve:"host,default"`
+	Mapping string            `json:"mapping,omitempty" pve:"mapping"`
+	USB3    int               `json:"usb3,omitempty" pve:"usb3"`
+	Extra   map[string]string `json:"extra,omitempty" pve:",extra"`
+}
+
+func (u *VirtualMachineUSB) String() string {
+	str, _ := MarshalPropertyString(u)
+	return str
+}
+
+func (vmc *VirtualMachineConfig) AgentOptions() (agent *VirtualMachineAgent, err error) {
+	agent = &VirtualMachineAgent{}
+	err = UnmarshalPropertyString(vmc.Agent.String(), agent)
+	return
+}
+
+func (vmc *VirtualMachineConfig) StartupOptions() (startup *VirtualMachineStartup, err error) {
+	startup = &VirtualMachineStartup{}
+	err = UnmarshalPropertyString(vmc.Startup, startup)
+	return
+}
+
+func (vmc *VirtualMachineConfig) HostPCI(name string) (hostpci *VirtualMachineHostPCI, err error) {
+	conf, ok := vmc.HostPCIs[strings.ToLower(name)]
+	if !ok {
+		return
+	}
+	hostpci = &VirtualMachineHostPCI{}
+	err = UnmarshalPropertyString(conf, hostpci)
+	return
+}
+
+func (vmc *VirtualMachineConfig) USB(name string) (usb *VirtualMachineUSB, err error) {
+	conf, ok := vmc.USBs[strings.ToLower(name)]
+	if !ok {
+		return
+	}
+	usb = &VirtualMachineUSB{}
+	err = UnmarshalPropertyString(conf, usb)
+	return
+}
@@ -2,21 +2,24 @@ package pve
 
 import "fmt"
 
+// FirewallVirtualMachineOption holds the firewall options of vms and
+// containers, pve returns the flags as 0/1. Flags left nil are not sent and
+// keep their current value, use NewIntOrBool to set one.
 type FirewallVirtualMachineOption struct {
-	Enable      bool   `json:"enable,omitempty"`
-	Dhcp        bool   `json:"dhcp,omitempty"`
-	Ipfilter    bool   `json:"ipfilter,omitempty"`
-	LogLevelIn  string `json:"log_level_in,omitempty"`
-	LogLevelOut string `json:"log_level_out,omitempty"`
-	Macfilter   bool   `json:"macfilter,omitempty"`
-	Ndp         bool   `json:"ndp,omitempty"`
-	PolicyIn    string `json:"policy_in,omitempty"`
-	PolicyOut   string `json:"policy_out,omitempty"`
-	Radv        bool   `json:"radv,omitempty"`
+	Enable      *IntOrBool `json:"enable,omitempty"`
+	Dhcp        *IntOrBool `json:"dhcp,omitempty"`
+	Ipfilter    *IntOrBool `json:"ipfilter,omitempty"`
+	LogLevelIn  string     `json:"log_level_in,omitempty"`
+	LogLevelOut string     `json:"log_level_out,omitempty"`
+	Macfilter   *IntOrBool `json:"macfilter,omitempty"`
+	Ndp         *IntOrBool `json:"ndp,omitempty"`
+	PolicyIn    string     `json:"policy_in,omitempty"`
+	PolicyOut   string     `json:"policy_out,omitempty"`
+	Radv        *IntOrBool `json:"radv,omitempty"`
 }
 
 func (v *VirtualMachine) FirewallOptionGet() (firewallOption *FirewallVirtualMachineOption, err error) {
-	err = v.client.Get(fmt.Sprintf("/nodes/%s/qemu/%d/firewall/options", v.Node, v.VMID), firewallOption)
+	err = v.client.Get(fmt.Sprintf("/nodes/%s/qemu/%d/firewall/options", v.Node, v.VMID), &firewallOption)
 	return
 }
 func (v *VirtualMachine) FirewallOptionSet(firewallOption *FirewallVirtualMachineOption) (err error) {
@@ -0,0 +1,43 @@
+package pve
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFirewallVirtualMachineOptionMarshal(t *testing.T) {
+	tests := []struct {
+		name   string
+		option FirewallVirtualMachineOption
+		want   string
+	}{
+		{name: "unset", want: `{}`},
+		{name: "enable only", option: FirewallVirtualMachineOption{Enable: NewIntOrBool(true)}, want: `{"enable":1}`},
+		{name: "explicit off", option: FirewallVirtualMachineOption{Dhcp: NewIntOrBool(false), PolicyIn: "DROP"}, want: `{"dhcp":0,"policy_in":"DROP"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(&tt.option)
+			if nil != err {
+				t.Fatal(err)
+			}
+			if got := string(b); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFirewallVirtualMachineOptionUnmarshal(t *testing.T) {
+	var option FirewallVirtualMachineOption
+	if err := json.Unmarshal([]byte(`{"enable":1,"dhcp":"0","radv":true}`), &option); nil != err {
+		t.Fatal(err)
+	}
+	if nil == option.Enable || !bool(*option.Enable) || nil == option.Dhcp || bool(*option.Dhcp) || nil == option.Radv || !bool(*option.Radv) {
+		t.Errorf("unexpected flags %+v", option)
+	}
+	if nil != option.Ndp {
+		t.Errorf("missing ndp decoded to %v", *option.Ndp)
+	}
+}
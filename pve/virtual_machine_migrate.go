@@ -0,0 +1,173 @@
+package pve
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	MigrationTypeSecure   = "secure"
+	MigrationTypeInsecure = "insecure"
+)
+
+type VirtualMachineMigrateOptions struct {
+	Online         bool
+	WithLocalDisks bool
+	// TargetStorage maps all local disks to one storage, StorageMap maps
+	// single source storages and takes precedence
+	TargetStorage    string
+	StorageMap       map[string]string
+	BWLimit          int // KiB/s
+	MigrationNetwork string
+	MigrationType    string
+	Force            bool
+}
+
+func (o *VirtualMachineMigrateOptions) params(target string) map[string]interface{} {
+	data := map[string]interface{}{"target": target}
+	if nil == o {
+		return data
+	}
+	if o.Online {
+		data["online"] = 1
+	}
+	if o.WithLocalDisks {
+		data["with-local-disks"] = 1
+	}
+	if targetStorage := idMapping(o.StorageMap, o.TargetStorage); "" != targetStorage {
+		data["targetstorage"] = targetStorage
+	}
+	if o.BWLimit > 0 {
+		data["bwlimit"] = o.BWLimit
+	}
+	if "" != o.MigrationNetwork {
+		data["migration_network"] = o.MigrationNetwork
+	}
+	if "" != o.MigrationType {
+		data["migration_type"] = o.MigrationType
+	}
+	if o.Force {
+		data["force"] = 1
+	}
+	return data
+}
+
+type VirtualMachineMigrateLocalDisk struct {
+	VolID              string    `json:"volid"`
+	DriveName          string    `json:"drivename,omitempty"`
+	Size               uint64    `json:"size,omitempty"`
+	CDROM              IntOrBool `json:"cdrom,omitempty"`
+	IsUnused           IntOrBool `json:"is_unused,omitempty"`
+	IsVMState          IntOrBool `json:"is_vmstate,omitempty"`
+	IsTPMState         IntOrBool `json:"is_tpmstate,omitempty"`
+	ReferencedInConfig IntOrBool `json:"referenced_in_config,omitempty"`
+	Replicate          IntOrBool `json:"replicate,omitempty"`
+}
+
+type VirtualMachineMigrateNotAllowed struct {
+	UnavailableStorages  []string `json:"unavailable_storages,omitempty"`
+	UnavailableResources []string `json:"unavailable-resources,omitempty"`
+}
+
+type VirtualMachineMigratePreconditions struct {
+	Running         IntOrBool                                   `json:"running"`
+	AllowedNodes    []string                                    `json:"allowed_nodes,omitempty"`
+	NotAllowedNodes map[string]*VirtualMachineMigrateNotAllowed `json:"not_allowed_nodes,omitempty"`
+	LocalDisks      []*VirtualMachineMigrateLocalDisk           `json:"local_disks,omitempty"`
+	LocalResources  []string                                    `json:"local_resources,omitempty"`
+	MappedResources []string                                    `json:"mapped-resources,omitempty"`
+}
+
+func (p *VirtualMachineMigratePreconditions) IsAllowed(node string) bool {
+	if _, ok := p.NotAllowedNodes[node]; ok {
+		return false
+	}
+	// allowed_nodes is only reported for stopped vms
+	if bool(p.Running) || len(p.AllowedNodes) == 0 {
+		return true
+	}
+	for _, n := range p.AllowedNodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
+
+// Check tells whether a migration to target with opts will be refused, the
+// returned error lists every reason.
+func (p *VirtualMachineMigratePreconditions) Check(target string, opts *VirtualMachineMigrateOptions) error {
+	if nil == opts {
+		opts = &VirtualMachineMigrateOptions{}
+	}
+
+	var errs []error
+	if !p.IsAllowed(target) {
+		reason := "node not allowed"
+		if na, ok := p.NotAllowedNodes[target]; ok && nil != na {
+			var items []string
+			if len(na.UnavailableStorages) > 0 {
+				items = append(items, "unavailable storages: "+strings.Join(na.UnavailableStorages, ", "))
+			}
+			if len(na.UnavailableResources) > 0 {
+				items = append(items, "unavailable resources: "+strings.Join(na.UnavailableResources, ", "))
+			}
+			if len(items) > 0 {
+				reason = strings.Join(items, "; ")
+			}
+		}
+		errs = append(errs, fmt.Errorf("can not migrate to %s: %s", target, reason))
+	}
+	if bool(p.Running) && !opts.Online {
+		errs = append(errs, fmt.Errorf("vm is running, online migration required"))
+	}
+	if len(p.LocalResources) > 0 && !opts.Force {
+		errs = append(errs, fmt.Errorf("vm uses local resources: %s", strings.Join(p.LocalResources, ", ")))
+	}
+	for _, disk := range p.LocalDisks {
+		if disk.CDROM {
+			errs = append(errs, fmt.Errorf("local cdrom %s attached", disk.VolID))
+			continue
+		}
+		// offline migrations copy local disks anyway
+		if bool(p.Running) && !opts.WithLocalDisks {
+			errs = append(errs, fmt.Errorf("local disk %s requires with local disks", disk.VolID))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// MigratePreconditions asks pve what would block a migration to target.
+func (v *VirtualMachine) MigratePreconditions(target string) (preconditions *VirtualMachineMigratePreconditions, err error) {
+	p := fmt.Sprintf("/nodes/%s/qemu/%d/migrate", v.Node, v.VMID)
+	if "" != target {
+		p = fmt.Sprintf("%s?target=%s", p, url.QueryEscape(target))
+	}
+	err = v.client.Get(p, &preconditions)
+	return
+}
+
+func (v *VirtualMachine) Migrate(target string, opts *VirtualMachineMigrateOptions) (task *Task, err error) {
+	var upid string
+	if err = v.client.Post(fmt.Sprintf("/nodes/%s/qemu/%d/migrate", v.Node, v.VMID), opts.params(target), &upid); err != nil {
+		return nil, err
+	}
+
+	return NewTask(upid, v.client), nil
+}
+
+// MigrateChecked runs the precondition check first and only starts the
+// migration when nothing blocks it.
+func (v *VirtualMachine) MigrateChecked(target string, opts *VirtualMachineMigrateOptions) (task *Task, err error) {
+	preconditions, err := v.MigratePreconditions(target)
+	if nil != err {
+		return
+	}
+	if err = preconditions.Check(target, opts); nil != err {
+		return
+	}
+	return v.Migrate(target, opts)
+}
@@ -0,0 +1,104 @@
+package pve
+
+import (
+	"fmt"
+	"strings"
+)
+
+// VirtualMachinePendingChange is one entry of the pending config. Value is the
+// current value, Pending the value that applies on the next start and Delete is
+// set (2 means forced) when the key will be removed.
+type VirtualMachinePendingChange struct {
+	Key     string          `json:"key"`
+	Value   *StringOrNumber `json:"value,omitempty"`
+	Pending *StringOrNumber `json:"pending,omitempty"`
+	Delete  int             `json:"delete,omitempty"`
+}
+
+func (c *VirtualMachinePendingChange) IsPending() bool {
+	return nil != c.Pending || c.Delete > 0
+}
+
+func (c *VirtualMachinePendingChange) OldValue() string {
+	if nil == c.Value {
+		return ""
+	}
+	return c.Value.String()
+}
+
+func (c *VirtualMachinePendingChange) NewValue() string {
+	if nil == c.Pending {
+		return ""
+	}
+	return c.Pending.String()
+}
+
+type VirtualMachinePendingChanges []*VirtualMachinePendingChange
+
+func (cs VirtualMachinePendingChanges) Keys() (keys []string) {
+	for _, c := range cs {
+		keys = append(keys, c.Key)
+	}
+	return
+}
+
+// PendingConfig returns every config key with its current and pending value.
+func (v *VirtualMachine) PendingConfig() (config VirtualMachinePendingChanges, err error) {
+	err = v.client.Get(fmt.Sprintf("/nodes/%s/qemu/%d/pending", v.Node, v.VMID), &config)
+	return
+}
+
+// PendingChanges returns only the keys that have a pending new value or delete.
+func (v *VirtualMachine) PendingChanges() (changes VirtualMachinePendingChanges, err error) {
+	config, err := v.PendingConfig()
+	if nil != err {
+		return
+	}
+	for _, c := range config {
+		if c.IsPending() {
+			changes = append(changes, c)
+		}
+	}
+	return
+}
+
+// Revert drops the pending changes of keys, without keys all pending changes
+// are reverted.
+func (v *VirtualMachine) Revert(keys ...string) (task *Task, err error) {
+	if len(keys) == 0 {
+		changes, err := v.PendingChanges()
+		if nil != err {
+			return nil, err
+		}
+		keys = changes.Keys()
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	var upid string
+	err = v.client.Post(fmt.Sprintf("/nodes/%s/qemu/%d/config", v.Node, v.VMID), map[string]string{
+		"revert": strings.Join(keys, ","),
+	}, &upid)
+	if nil != err {
+		return
+	}
+
+	return NewTask(upid, v.client), nil
+}
+
+// RebootRequired reports whether the vm is running with pending changes that
+// only apply after a reboot, together with the affected keys.
+func (v *VirtualMachine) RebootRequired() (required bool, keys []string, err error) {
+	changes, err := v.PendingChanges()
+	if nil != err || len(changes) == 0 {
+		return
+	}
+	if err = v.Ping(); nil != err {
+		return
+	}
+
+	keys = changes.Keys()
+	required = !v.IsStopped()
+	return
+}
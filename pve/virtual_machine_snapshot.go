@@ -1,6 +1,11 @@
 package pve
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+)
+
+const SnapshotCurrent = "current"
 
 type Snapshot struct {
 	Name        string
@@ -9,34 +14,201 @@ type Snapshot struct {
 	Snaptime    int64
 	Parent      string
 	Snapstate   string
+	Running     int         `json:",omitempty"`
+	Digest      string      `json:",omitempty"`
+	Children    []*Snapshot `json:"-"`
+}
+
+// IsCurrent reports whether this is the "current" entry, which marks the
+// position of the running state in the tree and is no real snapshot.
+func (s *Snapshot) IsCurrent() bool {
+	return SnapshotCurrent == s.Name
+}
+
+type SnapshotOptions struct {
+	// VMState includes the ram of a running vm, qemu only
+	VMState     bool
+	Description string
+}
+
+type Snapshots []*Snapshot
+
+func (ss Snapshots) Get(name string) *Snapshot {
+	for _, s := range ss {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func (ss Snapshots) Current() *Snapshot {
+	return ss.Get(SnapshotCurrent)
+}
+
+// WithoutCurrent returns the real snapshots only.
+func (ss Snapshots) WithoutCurrent() (snapshots Snapshots) {
+	for _, s := range ss {
+		if !s.IsCurrent() {
+			snapshots = append(snapshots, s)
+		}
+	}
+	return
+}
+
+// Tree links every snapshot to its children and returns the roots, children
+// are sorted by creation time and the current marker is placed last.
+func (ss Snapshots) Tree() (roots Snapshots) {
+	byName := map[string]*Snapshot{}
+	for _, s := range ss {
+		s.Children = nil
+		byName[s.Name] = s
+	}
+
+	for _, s := range ss {
+		if parent, ok := byName[s.Parent]; ok && "" != s.Parent && parent != s {
+			parent.Children = append(parent.Children, s)
+			continue
+		}
+		roots = append(roots, s)
+	}
+
+	sortSnapshots(roots)
+	for _, s := range ss {
+		sortSnapshots(s.Children)
+	}
+	return
+}
+
+func sortSnapshots(ss []*Snapshot) {
+	sort.SliceStable(ss, func(i, j int) bool {
+		if ss[i].IsCurrent() != ss[j].IsCurrent() {
+			return ss[j].IsCurrent()
+		}
+		return ss[i].Snaptime < ss[j].Snaptime
+	})
+}
+
+// guestSnapshots implements the snapshot endpoints shared by qemu and lxc,
+// path is the guest path like /nodes/pve/qemu/100.
+type guestSnapshots struct {
+	client *Client
+	path   string
 }
 
-func (v *VirtualMachine) NewSnapshot(name string) (task *Task, err error) {
+func (g guestSnapshots) create(name string, opts []*SnapshotOptions) (task *Task, err error) {
+	data := map[string]interface{}{"snapname": name}
+	if len(opts) > 0 && nil != opts[0] {
+		if opts[0].VMState {
+			data["vmstate"] = 1
+		}
+		if "" != opts[0].Description {
+			data["description"] = opts[0].Description
+		}
+	}
+
 	var upid string
-	if err = v.client.Post(fmt.Sprintf("/nodes/%s/qemu/%d/snapshot", v.Node, v.VMID), map[string]string{"snapname": name}, &upid); err != nil {
+	if err = g.client.Post(g.path+"/snapshot", data, &upid); err != nil {
 		return nil, err
 	}
 
-	return NewTask(upid, v.client), nil
+	return NewTask(upid, g.client), nil
 }
-func (v *VirtualMachine) Snapshots() (snapshots []*Snapshot, err error) {
-	err = v.client.Get(fmt.Sprintf("/nodes/%s/qemu/%d/snapshot", v.Node, v.VMID), &snapshots)
+
+func (g guestSnapshots) list() (snapshots Snapshots, err error) {
+	err = g.client.Get(g.path+"/snapshot", &snapshots)
 	return
 }
 
-func (v *VirtualMachine) SnapshotRollback(name string) (task *Task, err error) {
+func (g guestSnapshots) config(name string, v interface{}) error {
+	return g.client.Get(fmt.Sprintf("%s/snapshot/%s/config", g.path, name), v)
+}
+
+func (g guestSnapshots) updateDescription(name, description string) error {
+	return g.client.Put(fmt.Sprintf("%s/snapshot/%s/config", g.path, name), map[string]string{"description": description}, nil)
+}
+
+func (g guestSnapshots) rollback(name string) (task *Task, err error) {
 	var upid string
-	if err = v.client.Post(fmt.Sprintf("/nodes/%s/qemu/%d/snapshot/%s/rollback", v.Node, v.VMID, name), nil, &upid); err != nil {
+	if err = g.client.Post(fmt.Sprintf("%s/snapshot/%s/rollback", g.path, name), nil, &upid); err != nil {
 		return nil, err
 	}
 
-	return NewTask(upid, v.client), nil
+	return NewTask(upid, g.client), nil
 }
-func (v *VirtualMachine) SnapshotDelete(name string) (task *Task, err error) {
+
+func (g guestSnapshots) delete(name string) (task *Task, err error) {
 	var upid string
-	if err = v.client.Delete(fmt.Sprintf("/nodes/%s/qemu/%d/snapshot/%s", v.Node, v.VMID, name), &upid); err != nil {
+	if err = g.client.Delete(fmt.Sprintf("%s/snapshot/%s", g.path, name), &upid); err != nil {
 		return nil, err
 	}
 
-	return NewTask(upid, v.client), nil
+	return NewTask(upid, g.client), nil
+}
+
+func (v *VirtualMachine) snapshots() guestSnapshots {
+	return guestSnapshots{client: v.client, path: fmt.Sprintf("/nodes/%s/qemu/%d", v.Node, v.VMID)}
+}
+
+func (v *VirtualMachine) NewSnapshot(name string, opts ...*SnapshotOptions) (task *Task, err error) {
+	return v.snapshots().create(name, opts)
+}
+
+// Snapshots returns the flat list including the current marker, use Tree
+// for the hierarchy.
+func (v *VirtualMachine) Snapshots() (snapshots Snapshots, err error) {
+	return v.snapshots().list()
+}
+
+func (v *VirtualMachine) SnapshotConfig(name string) (config *VirtualMachineConfig, err error) {
+	err = v.snapshots().config(name, &config)
+	return
+}
+
+func (v *VirtualMachine) SnapshotUpdateDescription(name, description string) error {
+	return v.snapshots().updateDescription(name, description)
+}
+
+func (v *VirtualMachine) SnapshotRollback(name string) (task *Task, err error) {
+	return v.snapshots().rollback(name)
+}
+
+func (v *VirtualMachine) SnapshotDelete(name string) (task *Task, err error) {
+	return v.snapshots().delete(name)
+}
+
+func (c *LxcContainer) snapshots() guestSnapshots {
+	return guestSnapshots{client: c.client, path: fmt.Sprintf("/nodes/%s/lxc/%d", c.Node, c.VMID)}
+}
+
+// NewSnapshot creates a container snapshot, SnapshotOptions.VMState is not
+// supported by containers and ignored.
+func (c *LxcContainer) NewSnapshot(name string, opts ...*SnapshotOptions) (task *Task, err error) {
+	if len(opts) > 0 && nil != opts[0] && opts[0].VMState {
+		o := *opts[0]
+		o.VMState = false
+		opts = []*SnapshotOptions{&o}
+	}
+	return c.snapshots().create(name, opts)
+}
+
+func (c *LxcContainer) Snapshots() (snapshots Snapshots, err error) {
+	return c.snapshots().list()
+}
+
+func (c *LxcContainer) SnapshotConfig(name string) (config *LxcContainerConfig, err error) {
+	err = c.snapshots().config(name, &config)
+	return
+}
+
+func (c *LxcContainer) SnapshotUpdateDescription(name, description string) error {
+	return c.snapshots().updateDescription(name, description)
+}
+
+func (c *LxcContainer) SnapshotRollback(name string) (task *Task, err error) {
+	return c.snapshots().rollback(name)
+}
+
+func (c *LxcContainer) SnapshotDelete(name string) (task *Task, err error) {
+	return c.snapshots().delete(name)
 }
@@ -0,0 +1,148 @@
+package pve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrSnapshotNotConsistent is returned with the report when the freeze
+	// deadline thawed the guest before the snapshot finished, the snapshot
+	// exists but is only crash consistent
+	ErrSnapshotNotConsistent = errors.New("guest thawed before the snapshot finished")
+
+	// DefaultFreezeTimeout is the longest time guest filesystems stay frozen
+	DefaultFreezeTimeout = 60 * time.Second
+	// DefaultThawTimeout bounds the thaw retries after a consistent snapshot
+	DefaultThawTimeout = 30 * time.Second
+)
+
+type ConsistentSnapshotOptions struct {
+	SnapshotOptions
+	// FreezeTimeout is the safety deadline after which the filesystems are
+	// thawed even when the snapshot is still running, DefaultFreezeTimeout if 0
+	FreezeTimeout time.Duration
+}
+
+type ConsistentSnapshotReport struct {
+	Snapshot string
+	// Filesystems lists the mountpoints reported by the agent before freezing
+	Filesystems []*AgentFsInfo
+	FrozenCount int
+	ThawedCount int
+	// ThawedByDeadline is set when the safety deadline thawed the guest
+	// before the snapshot finished
+	ThawedByDeadline bool
+	FrozenFor        time.Duration
+}
+
+// ConsistentSnapshot freezes the guest filesystems through the agent, takes
+// the snapshot name and thaws again. The thaw runs on every path, also when
+// ctx ends, and at the latest when the freeze timeout passes, which fails
+// with ErrSnapshotNotConsistent.
+func (v *VirtualMachine) ConsistentSnapshot(ctx context.Context, name string, opts *ConsistentSnapshotOptions) (report *ConsistentSnapshotReport, err error) {
+	if nil == opts {
+		opts = &ConsistentSnapshotOptions{}
+	}
+	freezeTimeout := opts.FreezeTimeout
+	if freezeTimeout <= 0 {
+		freezeTimeout = DefaultFreezeTimeout
+	}
+	report = &ConsistentSnapshotReport{Snapshot: name}
+
+	if err = v.AgentPing(); nil != err {
+		return report, fmt.Errorf("guest agent not available: %w", err)
+	}
+	if report.Filesystems, err = v.AgentFsInfo(); nil != err {
+		return report, err
+	}
+
+	var thawOnce sync.Once
+	var thawErr error
+	frozenAt := time.Now()
+	thaw := func(byDeadline bool) {
+		thawOnce.Do(func() {
+			report.ThawedByDeadline = byDeadline
+			report.FrozenFor = time.Since(frozenAt)
+			report.ThawedCount, thawErr = v.agentThaw()
+		})
+	}
+
+	report.FrozenCount, err = v.AgentFsFreeze()
+	if nil != err {
+		// a freeze can fail half way, never leave anything frozen behind
+		thaw(false)
+		return report, errors.Join(fmt.Errorf("freeze guest filesystems: %w", err), thawErr)
+	}
+	deadline := time.AfterFunc(freezeTimeout, func() {
+		v.client.logger.InfoF("vm %d frozen for %s, thawing before snapshot %s finished", v.VMID, freezeTimeout, name)
+		thaw(true)
+	})
+	defer func() {
+		deadline.Stop()
+		thaw(false)
+		if nil == err && report.ThawedByDeadline {
+			err = ErrSnapshotNotConsistent
+		}
+		if nil != thawErr {
+			err = errors.Join(err, fmt.Errorf("thaw guest filesystems: %w", thawErr))
+		}
+	}()
+
+	snapshotOpts := opts.SnapshotOptions
+	task, err := v.NewSnapshot(name, &snapshotOpts)
+	if nil != err {
+		return
+	}
+	err = v.waitTaskContext(ctx, task)
+	return
+}
+
+// agentThaw thaws until the agent reports the filesystems thawed, retrying
+// errors for DefaultThawTimeout.
+func (v *VirtualMachine) agentThaw() (count int, err error) {
+	stop := time.Now().Add(DefaultThawTimeout)
+	for {
+		count, err = v.AgentFsThaw()
+		if nil == err {
+			var status string
+			if status, err = v.AgentFsFreezeStatus(); nil == err && AgentFsFreezeStatusThawed == status {
+				return
+			}
+			if nil == err {
+				err = fmt.Errorf("filesystems still %s", status)
+			}
+		}
+		if time.Now().After(stop) {
+			return
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// waitTaskContext polls task until it stops or ctx ends. The freeze deadline
+// only thaws the guest, a snapshot with vmstate may well run longer.
+func (v *VirtualMachine) waitTaskContext(ctx context.Context, task *Task) error {
+	ticker := time.NewTicker(DefaultWaitInterval)
+	defer ticker.Stop()
+	for {
+		if err := task.Ping(); nil != err {
+			return err
+		}
+		if task.IsCompleted {
+			if !task.IsSuccessful {
+				return fmt.Errorf("task %s failed: %s", task.UPID, task.ExitStatus)
+			}
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("task %s: %w", task.UPID, ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package pve
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConsistentSnapshot(t *testing.T) {
+	interval := DefaultWaitInterval
+	DefaultWaitInterval = 10 * time.Millisecond
+	defer func() { DefaultWaitInterval = interval }()
+
+	tests := []struct {
+		name          string
+		snapshotTakes time.Duration
+		wantErr       error
+		byDeadline    bool
+	}{
+		{name: "finished while frozen"},
+		{name: "thawed by deadline", snapshotTakes: 300 * time.Millisecond, wantErr: ErrSnapshotNotConsistent, byDeadline: true},
+	}
+
+	const upid = "UPID:pve1:00001234:00005678:65000000:qmsnapshot:100:root@pam:"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var started atomic.Int64
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case strings.HasPrefix(r.URL.Path, "/nodes/pve1/qemu/100/agent/"):
+					switch strings.TrimPrefix(r.URL.Path, "/nodes/pve1/qemu/100/agent/") {
+					case "get-fsinfo":
+						writeTestData(w, map[string]interface{}{"result": []interface{}{}})
+					case "fsfreeze-freeze", "fsfreeze-thaw":
+						writeTestData(w, map[string]interface{}{"result": 1})
+					case "fsfreeze-status":
+						writeTestData(w, map[string]interface{}{"result": AgentFsFreezeStatusThawed})
+					default:
+						writeTestData(w, map[string]interface{}{"result": map[string]interface{}{}})
+					}
+				case "/nodes/pve1/qemu/100/snapshot" == r.URL.Path:
+					started.Store(time.Now().UnixNano())
+					writeTestData(w, upid)
+				case strings.HasPrefix(r.URL.Path, "/nodes/pve1/tasks/"):
+					if time.Since(time.Unix(0, started.Load())) < tt.snapshotTakes {
+						writeTestData(w, map[string]interface{}{"upid": upid, "node": "pve1", "status": TaskRunning})
+						return
+					}
+					writeTestData(w, map[string]interface{}{"upid": upid, "node": "pve1", "status": "stopped", "exitstatus": "OK"})
+				default:
+					http.NotFound(w, r)
+				}
+			})
+
+			vm := &VirtualMachine{client: client, Node: "pve1", VMID: 100}
+			report, err := vm.ConsistentSnapshot(context.Background(), "snap", &ConsistentSnapshotOptions{FreezeTimeout: 30 * time.Millisecond})
+			if !errors.Is(err, tt.wantErr) || (nil == tt.wantErr && nil != err) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if nil == report {
+				t.Fatal("no report")
+			}
+			if report.ThawedByDeadline != tt.byDeadline {
+				t.Errorf("thawed by deadline %v, want %v", report.ThawedByDeadline, tt.byDeadline)
+			}
+			if 1 != report.FrozenCount || 1 != report.ThawedCount {
+				t.Errorf("frozen %d, thawed %d", report.FrozenCount, report.ThawedCount)
+			}
+		})
+	}
+}
@@ -3,12 +3,8 @@ package pve
 import (
 	"fmt"
 	"github.com/hilaoyu/go-utils/utilFile"
-	"github.com/hilaoyu/go-utils/utilStr"
 	"net/http"
 	"net/url"
-	"reflect"
-	"regexp"
-	"strconv"
 	"strings"
 )
 
@@ -18,22 +14,6 @@ const (
 	StatusVirtualMachinePaused  = "paused"
 )
 
-var (
-	vmConfigRegexpIDE    *regexp.Regexp
-	vmConfigRegexpSCSI   *regexp.Regexp
-	vmConfigRegexpSATA   *regexp.Regexp
-	vmConfigRegexpNet    *regexp.Regexp
-	vmConfigRegexpUnused *regexp.Regexp
-)
-
-func init() {
-	vmConfigRegexpIDE, _ = regexp.Compile("(?i:^IDE)[\\d]+$")
-	vmConfigRegexpSCSI, _ = regexp.Compile("(?i:^SCSI)[\\d]+$")
-	vmConfigRegexpSATA, _ = regexp.Compile("(?i:^SATA)[\\d]+$")
-	vmConfigRegexpNet, _ = regexp.Compile("(?i:^Net)[\\d]+$")
-	vmConfigRegexpUnused, _ = regexp.Compile("(?i:^Unused)[\\d]+$")
-}
-
 type IsTemplate bool
 
 func (it *IsTemplate) UnmarshalJSON(b []byte) error {
@@ -74,82 +54,7 @@ type VirtualMachine struct {
 	QMPStatus string     `json:"qmpstatus,omitempty"`
 	Template  IsTemplate // empty str if a vm, int 1 if a template
 	HA        HA         `json:",omitempty"`
-}
-
-type VirtualMachineConfig struct {
-	Cores   int
-	Numa    int
-	Memory  StringOrUint64
-	Sockets int
-	OSType  string
-	SMBios1 string
-	SCSIHW  string
-
-	Digest  string
-	Meta    string
-	Boot    string
-	VMGenID string
-	Name    string
-
-	IDEs map[string]*VirtualMachineDisk
-	IDE0 *VirtualMachineDisk
-	IDE1 *VirtualMachineDisk
-	IDE2 *VirtualMachineDisk
-	IDE3 *VirtualMachineDisk
-	IDE4 *VirtualMachineDisk
-	IDE5 *VirtualMachineDisk
-	IDE6 *VirtualMachineDisk
-	IDE7 *VirtualMachineDisk
-	IDE8 *VirtualMachineDisk
-	IDE9 *VirtualMachineDisk
-
-	SCSIs map[string]*VirtualMachineDisk
-	SCSI0 *VirtualMachineDisk
-	SCSI1 *VirtualMachineDisk
-	SCSI2 *VirtualMachineDisk
-	SCSI3 *VirtualMachineDisk
-	SCSI4 *VirtualMachineDisk
-	SCSI5 *VirtualMachineDisk
-	SCSI6 *VirtualMachineDisk
-	SCSI7 *VirtualMachineDisk
-	SCSI8 *VirtualMachineDisk
-	SCSI9 *VirtualMachineDisk
-
-	SATAs map[string]*VirtualMachineDisk
-	SATA0 *VirtualMachineDisk
-	SATA1 *VirtualMachineDisk
-	SATA2 *VirtualMachineDisk
-	SATA3 *VirtualMachineDisk
-	SATA4 *VirtualMachineDisk
-	SATA5 *VirtualMachineDisk
-	SATA6 *VirtualMachineDisk
-	SATA7 *VirtualMachineDisk
-	SATA8 *VirtualMachineDisk
-	SATA9 *VirtualMachineDisk
-
-	Nets map[string]*VirtualMachineNetwork
-	Net0 *VirtualMachineNetwork
-	Net1 *VirtualMachineNetwork
-	Net2 *VirtualMachineNetwork
-	Net3 *VirtualMachineNetwork
-	Net4 *VirtualMachineNetwork
-	Net5 *VirtualMachineNetwork
-	Net6 *VirtualMachineNetwork
-	Net7 *VirtualMachineNetwork
-	Net8 *VirtualMachineNetwork
-	Net9 *VirtualMachineNetwork
-
-	Unuseds map[string]*VirtualMachineDisk
-	Unused0 *VirtualMachineDisk
-	Unused1 *VirtualMachineDisk
-	Unused2 *VirtualMachineDisk
-	Unused3 *VirtualMachineDisk
-	Unused4 *VirtualMachineDisk
-	Unused5 *VirtualMachineDisk
-	Unused6 *VirtualMachineDisk
-	Unused7 *VirtualMachineDisk
-	Unused8 *VirtualMachineDisk
-	Unused9 *VirtualMachineDisk
+	Tags      string     `json:",omitempty"` // separated by ;
 }
 
 type VirtualMachineOptions []*VirtualMachineOption
@@ -158,312 +63,203 @@ type VirtualMachineOption struct {
 	Value interface{}
 }
 
+var vmNetworkModels = map[string]struct{}{
+	"e1000":         {},
+	"e1000-82540em": {},
+	"e1000-82544gc": {},
+	"e1000-82545em": {},
+	"e1000e":        {},
+	"i82551":        {},
+	"i82557b":       {},
+	"i82559er":      {},
+	"ne2k_isa":      {},
+	"ne2k_pci":      {},
+	"pcnet":         {},
+	"rtl8139":       {},
+	"virtio":        {},
+	"vmxnet3":       {},
+}
+
 type VirtualMachineNetwork struct {
-	Name     string `json:"name,omitempty"`
-	Type     string `json:"type,omitempty"`
-	Mac      string `json:"mac,omitempty"`
-	Bridge   string `json:"bridge,omitempty"`
-	Firewall int    `json:"firewall,omitempty"`
-	LinkDown int    `json:"link_down,omitempty"`
-	Mtu      int    `json:"mtu,omitempty"`
-	Queues   int    `json:"queues,omitempty"`
-	Rate     int    `json:"rate,omitempty"`
-	Tag      int    `json:"tag,omitempty"`
-	Trunks   string `json:"trunks,omitempty"`
+	propertyStringState
+	Name     string            `json:"name,omitempty"`
+	Type     string            `json:"type,omitempty"`
+	Mac      string            `json:"mac,omitempty"`
+	Bridge   string            `json:"bridge,omitempty" pve:"bridge"`
+	Firewall int               `json:"firewall,omitempty" pve:"firewall"`
+	LinkDown int               `json:"link_down,omitempty" pve:"link_down"`
+	Mtu      int               `json:"mtu,omitempty" pve:"mtu"`
+	Queues   int               `json:"queues,omitempty" pve:"queues"`
+	Rate     float64           `json:"rate,omitempty" pve:"rate"`
+	Tag      int               `json:"tag,omitempty" pve:"tag"`
+	Trunks   string            `json:"trunks,omitempty" pve:"trunks"`
+	Extra    map[string]string `json:"extra,omitempty" pve:",extra"`
 }
 
 func (vmn *VirtualMachineNetwork) UnmarshalJSON(b []byte) error {
-
-	netConfig := string(b)
-	netConfig = strings.Trim(netConfig, "\"")
-	if "" == netConfig {
-		return nil
-	}
-	regMacAddress, _ := regexp.Compile("([0-9A-Fa-f]{2}[:-]){5}([0-9A-Fa-f]{2})")
-	macOrg := regMacAddress.FindString(netConfig)
-	mac := strings.ToUpper(strings.ReplaceAll(macOrg, "-", ":"))
-
-	vmn.Mac = mac
-	items := strings.Split(netConfig, ",")
-	for _, item := range items {
-
-		switch {
-		case strings.HasSuffix(item, "="+macOrg):
-			vmn.Type = utilStr.Before(item, "="+macOrg)
-			break
-		case strings.HasPrefix(item, "bridge="):
-			vmn.Bridge = utilStr.After(item, "bridge=")
-			break
-
-		case strings.HasPrefix(item, "firewall="):
-			firewall, _ := strconv.Atoi(utilStr.After(item, "firewall="))
-			vmn.Firewall = firewall
-			break
-		case strings.HasPrefix(item, "link_down="):
-			linkDown, _ := strconv.Atoi(utilStr.After(item, "link_down="))
-			vmn.LinkDown = linkDown
-			break
-		case strings.HasPrefix(item, "mtu="):
-			mtu, _ := strconv.Atoi(utilStr.After(item, "mtu="))
-			vmn.LinkDown = mtu
-			break
-		case strings.HasPrefix(item, "queues="):
-			queues, _ := strconv.Atoi(utilStr.After(item, "queues="))
-			vmn.Queues = queues
-			break
-		case strings.HasPrefix(item, "rate="):
-			rate, _ := strconv.Atoi(utilStr.After(item, "rate="))
-			vmn.Rate = rate
-			break
-		case strings.HasPrefix(item, "tag="):
-			tag, _ := strconv.Atoi(utilStr.After(item, "rate="))
-			vmn.Tag = tag
-			break
-
-		case strings.HasPrefix(item, "trunks="):
-			vmn.Trunks = utilStr.After(item, "trunks=")
-			break
-
+	return vmn.Parse(configValueString(b))
+}
+
+// Parse reads a netN option like "virtio=BC:24:11:00:00:01,bridge=vmbr0,tag=20".
+// The model is accepted both as "<model>=<mac>" and as "model=<model>,macaddr=<mac>".
+func (vmn *VirtualMachineNetwork) Parse(conf string) error {
+	name := vmn.Name
+	*vmn = VirtualMachineNetwork{Name: name}
+
+	var rest []string
+	for _, item := range SplitPropertyString(conf) {
+		key, value, _ := strings.Cut(item, "=")
+		if _, ok := vmNetworkModels[key]; ok {
+			vmn.Type = key
+			vmn.Mac = value
+			continue
+		}
+		switch key {
+		case "model":
+			vmn.Type = value
+		case "macaddr":
+			vmn.Mac = value
 		default:
-			break
+			rest = append(rest, item)
 		}
 	}
-	return nil
-}
 
-func (vmc *VirtualMachineConfig) MergeIDEs() map[string]*VirtualMachineDisk {
-	if nil == vmc.IDEs {
-		vmc.IDEs = map[string]*VirtualMachineDisk{}
-		t := reflect.TypeOf(*vmc)
-		v := reflect.ValueOf(*vmc)
-		count := v.NumField()
-
-		for i := 0; i < count; i++ {
-			fn := t.Field(i).Name
-
-			if vmConfigRegexpIDE.MatchString(fn) {
-				fv, _ := v.Field(i).Interface().(*VirtualMachineDisk)
-				//fmt.Println(fn, fv)
-				if nil == fv {
-					continue
-				}
-				fv.Name = strings.ToLower(fn)
-				vmc.IDEs[strings.ToLower(fn)] = fv
-			}
-		}
-	}
-	return vmc.IDEs
-}
-func (vmc *VirtualMachineConfig) MergeSCSIs() map[string]*VirtualMachineDisk {
-	if nil == vmc.SCSIs {
-		vmc.SCSIs = map[string]*VirtualMachineDisk{}
-		t := reflect.TypeOf(*vmc)
-		v := reflect.ValueOf(*vmc)
-		count := v.NumField()
-
-		for i := 0; i < count; i++ {
-			fn := t.Field(i).Name
-
-			if vmConfigRegexpSCSI.MatchString(fn) {
-				fv, _ := v.Field(i).Interface().(*VirtualMachineDisk)
-				//fmt.Println(fn, fv)
-				if nil == fv {
-					continue
-				}
-				fv.Name = strings.ToLower(fn)
-				vmc.SCSIs[strings.ToLower(fn)] = fv
-			}
-		}
-	}
-	return vmc.SCSIs
+	return UnmarshalPropertyString(strings.Join(rest, ","), vmn)
 }
 
-func (vmc *VirtualMachineConfig) MergeSATAs() map[string]*VirtualMachineDisk {
-	if nil == vmc.SATAs {
-		vmc.SATAs = map[string]*VirtualMachineDisk{}
-		t := reflect.TypeOf(*vmc)
-		v := reflect.ValueOf(*vmc)
-		count := v.NumField()
-
-		for i := 0; i < count; i++ {
-			fn := t.Field(i).Name
-
-			if vmConfigRegexpSATA.MatchString(fn) {
-				fv, _ := v.Field(i).Interface().(*VirtualMachineDisk)
-				//fmt.Println(fn, fv)
-				if nil == fv {
-					continue
-				}
-				fv.Name = strings.ToLower(fn)
-				vmc.SATAs[strings.ToLower(fn)] = fv
-			}
-		}
+func (vmn *VirtualMachineNetwork) String() string {
+	options, _ := MarshalPropertyString(vmn)
+	model := vmn.Type
+	if "" != vmn.Mac {
+		model = fmt.Sprintf("%s=%s", vmn.Type, vmn.Mac)
 	}
-	return vmc.SATAs
-}
-func (vmc *VirtualMachineConfig) MergeUnuseds() map[string]*VirtualMachineDisk {
-	if nil == vmc.Unuseds {
-		vmc.Unuseds = map[string]*VirtualMachineDisk{}
-		t := reflect.TypeOf(*vmc)
-		v := reflect.ValueOf(*vmc)
-		count := v.NumField()
-
-		for i := 0; i < count; i++ {
-			fn := t.Field(i).Name
-
-			if vmConfigRegexpUnused.MatchString(fn) {
-				fv, _ := v.Field(i).Interface().(*VirtualMachineDisk)
-				//fmt.Println(fn, fv)
-				if nil == fv {
-					continue
-				}
-				fv.Name = strings.ToLower(fn)
-				vmc.Unuseds[strings.ToLower(fn)] = fv
-			}
-		}
+	if "" == model {
+		return options
 	}
-	return vmc.Unuseds
-}
-
-func (vmc *VirtualMachineConfig) MergeNets() map[string]*VirtualMachineNetwork {
-	if nil == vmc.Nets {
-		vmc.Nets = map[string]*VirtualMachineNetwork{}
-		t := reflect.TypeOf(*vmc)
-		v := reflect.ValueOf(*vmc)
-		count := v.NumField()
-
-		for i := 0; i < count; i++ {
-			fn := t.Field(i).Name
-
-			if vmConfigRegexpNet.MatchString(fn) {
-				fv, _ := v.Field(i).Interface().(*VirtualMachineNetwork)
-				//fmt.Println(fn, fv)
-				if nil == fv {
-					continue
-				}
-				fv.Name = strings.ToLower(fn)
-				vmc.Nets[strings.ToLower(fn)] = fv
-			}
-		}
+	if "" == options {
+		return model
 	}
-	return vmc.Nets
+	return model + "," + options
 }
 
 type VirtualMachineDisk struct {
-	Name      string `json:"name,omitempty"`
-	Storage   string `json:"storage,omitempty"`
-	File      string `json:"file,omitempty"`
-	Aio       string `json:"aio,omitempty"`
-	Cache     string `json:"cache,omitempty"`
-	Discard   string `json:"discard,omitempty"`
-	IoThread  int    `json:"iothread,omitempty"`
-	Replicate int    `json:"replicate,omitempty"`
-	Ro        int    `json:"ro,omitempty"`
-	Backup    int    `json:"backup,omitempty"`
-	SizeGb    int64  `json:"size_gb,omitempty"`
-	Ssd       int    `json:"ssd,omitempty"`
-	Media     string `json:"media,omitempty"`
-	Format    string `json:"format,omitempty"`
+	propertyStringState
+	Name    string `json:"name,omitempty"`
+	Storage string `json:"storage,omitempty"`
+	File    string `json:"file,omitempty" pve:"file,default"`
+	SizeGb  int64  `json:"size_gb,omitempty"`
+	Size    string `json:"size,omitempty" pve:"size"`
+	Format  string `json:"format,omitempty" pve:"format"`
+	Media   string `json:"media,omitempty" pve:"media"`
+
+	Aio          string `json:"aio,omitempty" pve:"aio"`
+	Cache        string `json:"cache,omitempty" pve:"cache"`
+	Discard      string `json:"discard,omitempty" pve:"discard"`
+	DetectZeroes int    `json:"detect_zeroes,omitempty" pve:"detect_zeroes"`
+	IoThread     int    `json:"iothread,omitempty" pve:"iothread"`
+	Queues       int    `json:"queues,omitempty" pve:"queues"`
+	Ssd          int    `json:"ssd,omitempty" pve:"ssd"`
+	Ro           int    `json:"ro,omitempty" pve:"ro"`
+	Backup       int    `json:"backup,omitempty" pve:"backup"`
+	Replicate    int    `json:"replicate,omitempty" pve:"replicate"`
+	Shared       int    `json:"shared,omitempty" pve:"shared"`
+	Snapshot     int    `json:"snapshot,omitempty" pve:"snapshot"`
+	ScsiBlock    int    `json:"scsiblock,omitempty" pve:"scsiblock"`
+	Rerror       string `json:"rerror,omitempty" pve:"rerror"`
+	Werror       string `json:"werror,omitempty" pve:"werror"`
+	ImportFrom   string `json:"import-from,omitempty" pve:"import-from"`
+
+	Serial  string `json:"serial,omitempty" pve:"serial"`
+	Wwn     string `json:"wwn,omitempty" pve:"wwn"`
+	Model   string `json:"model,omitempty" pve:"model"`
+	Product string `json:"product,omitempty" pve:"product"`
+	Vendor  string `json:"vendor,omitempty" pve:"vendor"`
+	Cyls    int    `json:"cyls,omitempty" pve:"cyls"`
+	Heads   int    `json:"heads,omitempty" pve:"heads"`
+	Secs    int    `json:"secs,omitempty" pve:"secs"`
+	Trans   string `json:"trans,omitempty" pve:"trans"`
+
+	Mbps          float64 `json:"mbps,omitempty" pve:"mbps"`
+	MbpsMax       float64 `json:"mbps_max,omitempty" pve:"mbps_max"`
+	MbpsRd        float64 `json:"mbps_rd,omitempty" pve:"mbps_rd"`
+	MbpsRdMax     float64 `json:"mbps_rd_max,omitempty" pve:"mbps_rd_max"`
+	MbpsWr        float64 `json:"mbps_wr,omitempty" pve:"mbps_wr"`
+	MbpsWrMax     float64 `json:"mbps_wr_max,omitempty" pve:"mbps_wr_max"`
+	Bps           uint64  `json:"bps,omitempty" pve:"bps"`
+	BpsMaxLength  uint64  `json:"bps_max_length,omitempty" pve:"bps_max_length"`
+	BpsRd         uint64  `json:"bps_rd,omitempty" pve:"bps_rd"`
+	BpsRdLength   uint64  `json:"bps_rd_max_length,omitempty" pve:"bps_rd_max_length"`
+	BpsWr         uint64  `json:"bps_wr,omitempty" pve:"bps_wr"`
+	BpsWrLength   uint64  `json:"bps_wr_max_length,omitempty" pve:"bps_wr_max_length"`
+	Iops          uint64  `json:"iops,omitempty" pve:"iops"`
+	IopsMax       uint64  `json:"iops_max,omitempty" pve:"iops_max"`
+	IopsMaxLength uint64  `json:"iops_max_length,omitempty" pve:"iops_max_length"`
+	IopsRd        uint64  `json:"iops_rd,omitempty" pve:"iops_rd"`
+	IopsRdMax     uint64  `json:"iops_rd_max,omitempty" pve:"iops_rd_max"`
+	IopsRdLength  uint64  `json:"iops_rd_max_length,omitempty" pve:"iops_rd_max_length"`
+	IopsWr        uint64  `json:"iops_wr,omitempty" pve:"iops_wr"`
+	IopsWrMax     uint64  `json:"iops_wr_max,omitempty" pve:"iops_wr_max"`
+	IopsWrLength  uint64  `json:"iops_wr_max_length,omitempty" pve:"iops_wr_max_length"`
+
+	// efidisk0 and tpmstate0 only
+	EfiType         string `json:"efitype,omitempty" pve:"efitype"`
+	PreEnrolledKeys int    `json:"pre-enrolled-keys,omitempty" pve:"pre-enrolled-keys"`
+	Version         string `json:"version,omitempty" pve:"version"`
+
+	Extra map[string]string `json:"extra,omitempty" pve:",extra"`
+
+	// SizeGb as parsed, Size is only rewritten when SizeGb was changed
+	parsedSizeGb int64
 }
 
 func (vmd *VirtualMachineDisk) UnmarshalJSON(b []byte) error {
+	return vmd.Parse(configValueString(b))
+}
 
-	conf := string(b)
-	conf = strings.Trim(conf, "\"")
-	if "" == conf {
-		return nil
-	}
-	regDiskFile := regexp.MustCompile(`([0-9A-Za-z_-]+):([0-9A-Za-z_\.\\/-]+)`)
-	ret := regDiskFile.FindStringSubmatch(conf)
-	if len(ret) >= 3 {
-		vmd.Storage = ret[1]
-		vmd.File = ret[2]
-	}
-
-	items := strings.Split(conf, ",")
-	for _, item := range items {
-
-		switch {
-		case strings.HasPrefix(item, "aio="):
-			vmd.Aio = utilStr.After(item, "aio=")
-			break
-		case strings.HasPrefix(item, "cache="):
-			vmd.Cache = utilStr.After(item, "cache=")
-			break
-		case strings.HasPrefix(item, "discard="):
-			vmd.Discard = utilStr.After(item, "discard=")
-			break
-		case strings.HasPrefix(item, "media="):
-			vmd.Media = utilStr.After(item, "media=")
-			break
-		case strings.HasPrefix(item, "format="):
-			vmd.Format = utilStr.After(item, "format=")
-			break
-
-		case strings.HasPrefix(item, "iothread="):
-			thread, _ := strconv.Atoi(utilStr.After(item, "iothread="))
-			vmd.IoThread = thread
-			break
-		case strings.HasPrefix(item, "replicate="):
-			replicate, _ := strconv.Atoi(utilStr.After(item, "replicate="))
-			vmd.Replicate = replicate
-			break
-		case strings.HasPrefix(item, "ro="):
-			ro, _ := strconv.Atoi(utilStr.After(item, "ro="))
-			vmd.Ro = ro
-			break
-		case strings.HasPrefix(item, "backup="):
-			backup, _ := strconv.Atoi(utilStr.After(item, "backup="))
-			vmd.Backup = backup
-			break
-		case strings.HasPrefix(item, "ssd="):
-			ssd, _ := strconv.Atoi(utilStr.After(item, "ssd="))
-			vmd.Ssd = ssd
-			break
-		case strings.HasPrefix(item, "size="):
-			size, _ := utilFile.SizeStringToNumber(utilStr.After(item, "size="), "g")
-			vmd.SizeGb = size
-			break
+// Parse reads a disk option like "local-lvm:vm-100-disk-0,iothread=1,size=32G",
+// the volume is split into Storage and File.
+func (vmd *VirtualMachineDisk) Parse(conf string) (err error) {
+	name := vmd.Name
+	*vmd = VirtualMachineDisk{Name: name}
+	if err = UnmarshalPropertyString(conf, vmd); nil != err {
+		return
+	}
 
-		default:
-			break
-		}
+	if storage, file, ok := strings.Cut(vmd.File, ":"); ok && !strings.HasPrefix(vmd.File, "/") {
+		vmd.Storage = storage
+		vmd.File = file
 	}
-	return nil
+	if "" != vmd.Size {
+		vmd.SizeGb, _ = utilFile.SizeStringToNumber(vmd.Size, "g")
+		vmd.parsedSizeGb = vmd.SizeGb
+	}
+	return
 }
+
 func (vmd *VirtualMachineDisk) SourcePath() string {
+	if "" == vmd.Storage {
+		return vmd.File
+	}
 	return fmt.Sprintf("%s:%s", vmd.Storage, vmd.File)
 }
+
+// ToConfigOptions returns every property of the disk except the volume itself.
 func (vmd *VirtualMachineDisk) ToConfigOptions() (options []string) {
-	if "" != vmd.Aio {
-		options = append(options, fmt.Sprintf("aio=%s", vmd.Aio))
-	}
-	if "" != vmd.Cache {
-		options = append(options, fmt.Sprintf("cache=%s", vmd.Cache))
-	}
-	if "" != vmd.Discard {
-		options = append(options, fmt.Sprintf("discard=%s", vmd.Discard))
-	}
-	if "" != vmd.Media {
-		options = append(options, fmt.Sprintf("media=%s", vmd.Media))
-	}
-	if vmd.IoThread > 0 {
-		options = append(options, fmt.Sprintf("iothread=%d", vmd.IoThread))
-	}
-	if vmd.Replicate > 0 {
-		options = append(options, fmt.Sprintf("replicate=%d", vmd.Replicate))
-	}
-	if vmd.Ro > 0 {
-		options = append(options, fmt.Sprintf("ro=%d", vmd.Ro))
-	}
-	if vmd.Backup > 0 {
-		options = append(options, fmt.Sprintf("backup=%d", vmd.Backup))
-	}
-	if vmd.Ssd > 0 {
-		options = append(options, fmt.Sprintf("ssd=%d", vmd.Ssd))
+	tmp := *vmd
+	tmp.File = ""
+	if vmd.SizeGb > 0 && ("" == vmd.Size || vmd.SizeGb != vmd.parsedSizeGb) {
+		tmp.Size = fmt.Sprintf("%dG", vmd.SizeGb)
 	}
+	str, _ := MarshalPropertyString(&tmp)
+	return SplitPropertyString(str)
+}
 
-	return
+func (vmd *VirtualMachineDisk) String() string {
+	options := vmd.ToConfigOptions()
+	if volume := vmd.SourcePath(); "" != volume {
+		options = append([]string{volume}, options...)
+	}
+	return strings.Join(options, ",")
 }
 
 func (v *VirtualMachine) Ping() error {
@@ -479,6 +275,74 @@ func (v *VirtualMachine) Config(options ...VirtualMachineOption) (*Task, error)
 	err := v.client.Post(fmt.Sprintf("/nodes/%s/qemu/%d/config", v.Node, v.VMID), data, &upid)
 	return NewTask(upid, v.client), err
 }
+
+// ConfigUpdate posts options guarded by digest, an empty digest updates
+// unconditionally. The update runs as a task and pve checks the digest in the
+// task worker, so a conflict usually shows up as a failed task, use
+// WaitConfigTask to get it as a *ConfigConflictError. Only conflicts detected
+// before the task starts are returned here directly.
+func (v *VirtualMachine) ConfigUpdate(digest string, options ...VirtualMachineOption) (*Task, error) {
+	var upid string
+	data := make(map[string]interface{})
+	for _, opt := range options {
+		data[opt.Name] = opt.Value
+	}
+	if "" != digest {
+		data["digest"] = digest
+	}
+	err := v.client.Post(fmt.Sprintf("/nodes/%s/qemu/%d/config", v.Node, v.VMID), data, &upid)
+	if isConfigConflict(err) {
+		return nil, &ConfigConflictError{Digest: digest, Err: err}
+	}
+	return NewTask(upid, v.client), err
+}
+
+// ConfigUpdateLoaded is ConfigUpdate with the digest of the loaded config.
+func (v *VirtualMachine) ConfigUpdateLoaded(options ...VirtualMachineOption) (*Task, error) {
+	if nil == v.VirtualMachineConfig {
+		return nil, fmt.Errorf("vm %d config not loaded", v.VMID)
+	}
+	return v.ConfigUpdate(v.VirtualMachineConfig.Digest, options...)
+}
+
+// WaitConfigTask waits for the task of a config update and maps a digest
+// mismatch reported by the task to a *ConfigConflictError.
+func WaitConfigTask(task *Task, digest string, err error) error {
+	if nil == err && nil != task {
+		err = task.WaitForComplete(10, 3)
+	}
+	if isConfigConflict(err) && !IsConfigConflict(err) {
+		err = &ConfigConflictError{Digest: digest, Err: err}
+	}
+	return err
+}
+
+// ConfigModify does a read-modify-write of the vm config. modify gets a freshly
+// loaded config and returns the options to set, on a digest conflict the config
+// is reloaded and modify called again, up to retries times.
+func (v *VirtualMachine) ConfigModify(modify func(config *VirtualMachineConfig) ([]VirtualMachineOption, error), retries int) (err error) {
+	for attempt := 0; attempt <= retries; attempt++ {
+		if err = v.ConfigLoad(true); nil != err {
+			return
+		}
+
+		var options []VirtualMachineOption
+		options, err = modify(v.VirtualMachineConfig)
+		if nil != err || len(options) == 0 {
+			return
+		}
+
+		var task *Task
+		task, err = v.ConfigUpdateLoaded(options...)
+		if err = WaitConfigTask(task, v.VirtualMachineConfig.Digest, err); !IsConfigConflict(err) {
+			return
+		}
+		v.client.logger.DebugF("config of vm %d modified concurrently, retry %d of %d", v.VMID, attempt+1, retries)
+	}
+
+	return
+}
+
 func (v *VirtualMachine) ConfigLoad(force ...bool) (err error) {
 	if nil == v.VirtualMachineConfig || (len(force) > 0 && force[0]) {
 		err = v.client.Get(fmt.Sprintf("/nodes/%s/qemu/%d/config", v.Node, v.VMID), &v.VirtualMachineConfig)
@@ -638,27 +502,98 @@ func (v *VirtualMachine) Delete() (task *Task, err error) {
 	return NewTask(upid, v.client), nil
 }
 
+type VirtualMachineCloneOptions struct {
+	// NewID of the clone, a free id is allocated when 0
+	NewID  int
+	Name   string
+	Target string
+	// Full forces a full copy, Linked a linked clone of a template. Without
+	// either pve clones vms fully and templates linked
+	Full        bool
+	Linked      bool
+	Storage     string
+	Format      string
+	Pool        string
+	Description string
+	SnapName    string
+	BWLimit     int // KiB/s
+}
+
+func (o *VirtualMachineCloneOptions) params(newid int) map[string]interface{} {
+	data := map[string]interface{}{"newid": newid}
+	if "" != o.Name {
+		data["name"] = o.Name
+	}
+	if "" != o.Target {
+		data["target"] = o.Target
+	}
+	if o.Full {
+		data["full"] = 1
+	} else if o.Linked {
+		data["full"] = 0
+	}
+	if "" != o.Storage {
+		data["storage"] = o.Storage
+	}
+	if "" != o.Format {
+		data["format"] = o.Format
+	}
+	if "" != o.Pool {
+		data["pool"] = o.Pool
+	}
+	if "" != o.Description {
+		data["description"] = o.Description
+	}
+	if "" != o.SnapName {
+		data["snapname"] = o.SnapName
+	}
+	if o.BWLimit > 0 {
+		data["bwlimit"] = o.BWLimit
+	}
+	return data
+}
+
 func (v *VirtualMachine) Clone(name, target string) (newid int, task *Task, err error) {
+	return v.CloneWithOptions(&VirtualMachineCloneOptions{Name: name, Target: target})
+}
+
+func (v *VirtualMachine) CloneWithOptions(opts *VirtualMachineCloneOptions) (newid int, task *Task, err error) {
+	if nil == opts {
+		opts = &VirtualMachineCloneOptions{}
+	}
+	if opts.Full && opts.Linked {
+		return 0, nil, fmt.Errorf("full and linked clone are exclusive")
+	}
+
 	var upid string
-	cluster, err := v.client.Cluster()
-	if err != nil {
-		return newid, nil, err
+	clone := func(id int) error {
+		return v.client.Post(fmt.Sprintf("/nodes/%s/qemu/%d/clone", v.Node, v.VMID), opts.params(id), &upid)
 	}
 
-	newid, err = cluster.NextID()
+	newid = opts.NewID
+	if 0 == newid {
+		var cluster *Cluster
+		if cluster, err = v.client.Cluster(); err != nil {
+			return newid, nil, err
+		}
+		newid, err = cluster.AllocateVMID(clone)
+	} else {
+		err = clone(newid)
+	}
 	if err != nil {
 		return newid, nil, err
 	}
 
-	if err := v.client.Post(fmt.Sprintf("/nodes/%s/qemu/%d/clone", v.Node, v.VMID), map[string]string{
-		"newid":  strconv.Itoa(newid),
-		"name":   name,
-		"target": target,
-	}, &upid); err != nil {
-		return newid, nil, err
+	return newid, NewTask(upid, v.client), nil
+}
+
+func (v *VirtualMachine) ConvertToTemplate() (task *Task, err error) {
+	var upid string
+	if err := v.client.Post(fmt.Sprintf("/nodes/%s/qemu/%d/template", v.Node, v.VMID), nil, &upid); err != nil {
+		return nil, err
 	}
 
-	return newid, NewTask(upid, v.client), nil
+	return NewTask(upid, v.client), nil
 }
 func (v *VirtualMachine) MoveDisk(diskName, storage string, format ...string) (task *Task, err error) {
 	var upid string
@@ -697,111 +632,102 @@ func (v *VirtualMachine) GetDisk(diskName string) (disk *VirtualMachineDisk, err
 	if nil != err {
 		return
 	}
-	switch {
-	case vmConfigRegexpSCSI.MatchString(diskName):
-		disks := v.VirtualMachineConfig.MergeSCSIs()
-		if tmp, ok := disks[diskName]; ok {
-			disk = tmp
-		}
-		break
-	case vmConfigRegexpSATA.MatchString(diskName):
-		disks := v.VirtualMachineConfig.MergeSATAs()
-		if tmp, ok := disks[diskName]; ok {
-			disk = tmp
-		}
-		break
-	case vmConfigRegexpIDE.MatchString(diskName):
-		disks := v.VirtualMachineConfig.MergeIDEs()
-		if tmp, ok := disks[diskName]; ok {
-			disk = tmp
-		}
-		break
-	case vmConfigRegexpUnused.MatchString(diskName):
-		disks := v.VirtualMachineConfig.MergeUnuseds()
-		if tmp, ok := disks[diskName]; ok {
-			disk = tmp
-		}
-		break
-
-	}
+	disk = v.VirtualMachineConfig.Disk(diskName)
 
 	return
 }
-func (v *VirtualMachine) ChangeDisk(diskName string, disk *VirtualMachineDisk, storage string) (err error) {
+func (v *VirtualMachine) ChangeDisk(diskName string, disk *VirtualMachineDisk, storage string, onProgress ...func(progress *WorkflowProgress)) (err error) {
 	if nil == disk {
 		err = fmt.Errorf("disk can not be nil")
 		return
 	}
-	needStart := false
-	var task *Task
-	if !v.IsStopped() {
-		needStart = true
-		task, err = v.Stop()
-		if nil != err {
-			return
-		}
-		err = task.WaitForComplete(36, 5)
-		if nil != err {
-			err = fmt.Errorf("vm stop faild: %v", err)
-			return
-		}
-	}
 
+	needStart := !v.IsStopped()
 	diskSizeGb := disk.SizeGb
+	var existDisk *VirtualMachineDisk
 
-	existDisk, err := v.GetDisk(diskName)
-	if nil != err {
-		return
+	wf := NewWorkflow(fmt.Sprintf("change disk %s of vm %d", diskName, v.VMID))
+	if len(onProgress) > 0 {
+		wf.OnProgress = onProgress[0]
 	}
-	if nil != existDisk {
-		if "" == storage {
-			storage = existDisk.Storage
+
+	wf.AddStep(&WorkflowStep{
+		Name:       "stop",
+		Run:        WaitTaskFunc(v.Stop, 36, 5),
+		Compensate: WaitTaskFunc(v.Start, 36, 5),
+		Skip: func() bool {
+			return !needStart
+		},
+	})
+	wf.Step("inspect", func() (err error) {
+		existDisk, err = v.GetDisk(diskName)
+		if nil != err {
+			return
+		}
+		if nil != existDisk {
+			if "" == storage {
+				storage = existDisk.Storage
+			}
+			if existDisk.SizeGb > diskSizeGb {
+				diskSizeGb = existDisk.SizeGb
+			}
 		}
-		if existDisk.SizeGb > diskSizeGb {
-			diskSizeGb = existDisk.SizeGb
+		if "" == storage {
+			err = fmt.Errorf("storage is empty")
 		}
-	}
-	if "" == storage {
-		err = fmt.Errorf("storage is empty")
 		return
-	}
-
-	options := disk.ToConfigOptions()
-	options = append(options, fmt.Sprintf("%s:0", storage), fmt.Sprintf("import-from=%s", disk.SourcePath()))
-	task, err = v.Config(VirtualMachineOption{
-		Name:  diskName,
-		Value: strings.Join(options, ","),
+	}, nil)
+	// inspect loaded the config, the swap fails instead of overwriting a
+	// concurrent change
+	wf.Step("import", func() error {
+		newDisk := *disk
+		newDisk.Storage = storage
+		newDisk.File = "0"
+		newDisk.ImportFrom = disk.SourcePath()
+		newDisk.Size = ""
+		newDisk.SizeGb = 0
+		task, err := v.ConfigUpdateLoaded(VirtualMachineOption{
+			Name:  diskName,
+			Value: newDisk.String(),
+		})
+		return WaitConfigTask(task, v.VirtualMachineConfig.Digest, err)
+	}, func() error {
+		if err := v.ConfigLoad(true); nil != err {
+			return err
+		}
+		// a new slot is removed again, force destroys the imported volume
+		// instead of leaving it behind as unusedN
+		options := []VirtualMachineOption{{Name: "delete", Value: diskName}, {Name: "force", Value: 1}}
+		if nil != existDisk {
+			options = []VirtualMachineOption{{Name: diskName, Value: existDisk.String()}}
+		}
+		task, err := v.ConfigUpdateLoaded(options...)
+		return WaitConfigTask(task, v.VirtualMachineConfig.Digest, err)
 	})
-	if nil != err {
-		return
-	}
-	err = task.WaitForComplete(10, 3)
-	if nil != err {
-		err = fmt.Errorf("vm config disk faild: %v", err)
-		return
-	}
-
-	newDisk, err := v.GetDisk(diskName)
-	if nil != err {
-		return
-	}
-	if diskSizeGb > newDisk.SizeGb {
-		task, err = v.Resize(diskName, diskSizeGb)
-		err = task.WaitForComplete(10, 3)
+	wf.Step("resize", func() (err error) {
+		newDisk, err := v.GetDisk(diskName)
 		if nil != err {
-			err = fmt.Errorf("vm disk %s resize faild: %v", diskName, err)
 			return
 		}
-	}
-
-	if needStart {
-		task, err = v.Start()
-		err = task.WaitForComplete(36, 5)
-		if nil != err {
-			err = fmt.Errorf("vm start faild: %v", err)
+		if nil == newDisk {
+			return fmt.Errorf("disk %s not found after import", diskName)
+		}
+		if diskSizeGb <= newDisk.SizeGb {
 			return
 		}
-	}
+		return WaitTaskFunc(func() (*Task, error) {
+			return v.Resize(diskName, diskSizeGb)
+		}, 10, 3)()
+	}, nil)
+	// the new disk is committed at this point, a vm that fails to boot keeps it
+	wf.AddStep(&WorkflowStep{
+		Name: "start",
+		Run:  WaitTaskFunc(v.Start, 36, 5),
+		Skip: func() bool {
+			return !needStart
+		},
+		NoRollback: true,
+	})
 
-	return
+	return wf.Run()
 }
@@ -0,0 +1,42 @@
+package pve
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestVirtualMachineCloneFailure(t *testing.T) {
+	tests := []struct {
+		name  string
+		newID int
+	}{
+		{name: "allocated vmid"},
+		{name: "explicit vmid", newID: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/cluster/status":
+					writeTestData(w, []interface{}{})
+				case "/cluster/nextid":
+					writeTestData(w, "105")
+				case "/nodes/pve1/qemu/100/clone":
+					http.Error(w, "clone failed", http.StatusInternalServerError)
+				default:
+					http.NotFound(w, r)
+				}
+			})
+
+			vm := &VirtualMachine{client: client, Node: "pve1", VMID: 100}
+			_, task, err := vm.CloneWithOptions(&VirtualMachineCloneOptions{Name: "copy", NewID: tt.newID})
+			if nil == err {
+				t.Fatal("failed clone returned no error")
+			}
+			if nil != task {
+				t.Errorf("failed clone returned task %s", task.UPID)
+			}
+		})
+	}
+}
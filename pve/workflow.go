@@ -0,0 +1,181 @@
+package pve
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	WorkflowStepRunning     = "running"
+	WorkflowStepDone        = "done"
+	WorkflowStepFailed      = "failed"
+	WorkflowStepSkipped     = "skipped"
+	WorkflowStepRollingBack = "rolling-back"
+	WorkflowStepRolledBack  = "rolled-back"
+	WorkflowStepRollbackErr = "rollback-failed"
+)
+
+// WorkflowStep is a single unit of a Workflow. Run does the work, Compensate
+// undoes it and is only called when a later step fails. Skip, when set, is
+// evaluated right before Run and lets a step opt out at execution time.
+// NoRollback marks a step after the point of no return, when it fails the
+// completed steps are kept and not compensated.
+type WorkflowStep struct {
+	Name       string
+	Run        func() error
+	Compensate func() error
+	Skip       func() bool
+	NoRollback bool
+}
+
+type WorkflowProgress struct {
+	Workflow string
+	Step     string
+	Index    int
+	Total    int
+	State    string
+	Err      error
+}
+
+type WorkflowError struct {
+	Workflow       string
+	Step           string
+	Err            error
+	RollbackErrors []error
+	// NoRollback is set when the failed step was marked NoRollback and the
+	// completed steps were kept
+	NoRollback bool
+}
+
+func (e *WorkflowError) Error() string {
+	msg := fmt.Sprintf("workflow %s failed at step %s: %v", e.Workflow, e.Step, e.Err)
+	if len(e.RollbackErrors) > 0 {
+		errs := make([]string, 0, len(e.RollbackErrors))
+		for _, err := range e.RollbackErrors {
+			errs = append(errs, err.Error())
+		}
+		msg += fmt.Sprintf("; rollback errors: %s", strings.Join(errs, "; "))
+	}
+	return msg
+}
+
+func (e *WorkflowError) Unwrap() error {
+	return e.Err
+}
+
+// RolledBack reports whether every compensating action succeeded. It is false
+// when the failed step was marked NoRollback, nothing was undone then.
+func (e *WorkflowError) RolledBack() bool {
+	return !e.NoRollback && len(e.RollbackErrors) == 0
+}
+
+// Workflow runs its steps in order. When a step fails the compensating actions
+// of all previously completed steps are run in reverse order.
+type Workflow struct {
+	Name       string
+	OnProgress func(progress *WorkflowProgress)
+	steps      []*WorkflowStep
+}
+
+func NewWorkflow(name string) *Workflow {
+	return &Workflow{Name: name}
+}
+
+func (w *Workflow) AddStep(step *WorkflowStep) *Workflow {
+	w.steps = append(w.steps, step)
+	return w
+}
+
+func (w *Workflow) Step(name string, run func() error, compensate func() error) *Workflow {
+	return w.AddStep(&WorkflowStep{Name: name, Run: run, Compensate: compensate})
+}
+
+func (w *Workflow) TaskStep(name string, run func() (*Task, error), compensate func() (*Task, error), timesNum int, stepSeconds ...int) *Workflow {
+	step := &WorkflowStep{Name: name, Run: WaitTaskFunc(run, timesNum, stepSeconds...)}
+	if nil != compensate {
+		step.Compensate = WaitTaskFunc(compensate, timesNum, stepSeconds...)
+	}
+	return w.AddStep(step)
+}
+
+func (w *Workflow) Steps() []*WorkflowStep {
+	return w.steps
+}
+
+func (w *Workflow) Run() (err error) {
+	var done []int
+
+	for i, step := range w.steps {
+		if nil != step.Skip && step.Skip() {
+			w.progress(step, i, WorkflowStepSkipped, nil)
+			continue
+		}
+
+		w.progress(step, i, WorkflowStepRunning, nil)
+		if nil != step.Run {
+			err = step.Run()
+		}
+		if nil != err {
+			w.progress(step, i, WorkflowStepFailed, err)
+			wfErr := &WorkflowError{Workflow: w.Name, Step: step.Name, Err: err, NoRollback: step.NoRollback}
+			if !step.NoRollback {
+				wfErr.RollbackErrors = w.rollback(done)
+			}
+			return wfErr
+		}
+
+		w.progress(step, i, WorkflowStepDone, nil)
+		done = append(done, i)
+	}
+
+	return nil
+}
+
+func (w *Workflow) rollback(done []int) (errs []error) {
+	for j := len(done) - 1; j >= 0; j-- {
+		i := done[j]
+		step := w.steps[i]
+		if nil == step.Compensate {
+			continue
+		}
+
+		w.progress(step, i, WorkflowStepRollingBack, nil)
+		if err := step.Compensate(); nil != err {
+			err = fmt.Errorf("compensate %s: %w", step.Name, err)
+			w.progress(step, i, WorkflowStepRollbackErr, err)
+			errs = append(errs, err)
+			continue
+		}
+		w.progress(step, i, WorkflowStepRolledBack, nil)
+	}
+	return
+}
+
+func (w *Workflow) progress(step *WorkflowStep, index int, state string, err error) {
+	if nil == w.OnProgress {
+		return
+	}
+	w.OnProgress(&WorkflowProgress{
+		Workflow: w.Name,
+		Step:     step.Name,
+		Index:    index,
+		Total:    len(w.steps),
+		State:    state,
+		Err:      err,
+	})
+}
+
+// WaitTaskFunc adapts an api call that starts a task into a step function that
+// blocks until the task has completed successfully.
+func WaitTaskFunc(run func() (*Task, error), timesNum int, stepSeconds ...int) func() error {
+	return func() error {
+		task, err := run()
+		if nil != err {
+			return err
+		}
+		if nil == task {
+			return nil
+		}
+		return task.WaitForComplete(timesNum, stepSeconds...)
+	}
+}
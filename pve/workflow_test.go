@@ -0,0 +1,45 @@
+package pve
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWorkflowRolledBack(t *testing.T) {
+	tests := []struct {
+		name        string
+		noRollback  bool
+		compensated bool
+		rolledBack  bool
+	}{
+		{name: "compensated", compensated: true, rolledBack: true},
+		{name: "no rollback step", noRollback: true, compensated: false, rolledBack: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compensated := false
+			wf := NewWorkflow("test")
+			wf.Step("first", func() error { return nil }, func() error {
+				compensated = true
+				return nil
+			})
+			wf.AddStep(&WorkflowStep{
+				Name:       "second",
+				Run:        func() error { return errors.New("boom") },
+				NoRollback: tt.noRollback,
+			})
+
+			var wfErr *WorkflowError
+			if err := wf.Run(); !errors.As(err, &wfErr) {
+				t.Fatalf("got %v, want a *WorkflowError", err)
+			}
+			if compensated != tt.compensated {
+				t.Errorf("compensated %v, want %v", compensated, tt.compensated)
+			}
+			if wfErr.RolledBack() != tt.rolledBack {
+				t.Errorf("RolledBack %v, want %v", wfErr.RolledBack(), tt.rolledBack)
+			}
+		})
+	}
+}